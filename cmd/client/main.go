@@ -2,7 +2,9 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"fmt"
+	"github.com/ivanlp-p/ShortLinkService/internal/tracing"
 	"io"
 	"log"
 	"net/http"
@@ -37,6 +39,10 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	// передаём контекст трассировки, чтобы запрос попал в ту же трассу, что и сервер
+	ctx, span := tracing.Default.Start(context.Background(), "client.shorten", tracing.SpanKindClient)
+	defer span.End()
+	tracing.Inject(ctx, request.Header)
 	// в заголовках запроса указываем кодировку
 	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 	// отправляем запрос и получаем ответ
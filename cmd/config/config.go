@@ -1,8 +1,18 @@
 package config
 
 import (
+	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 )
 
@@ -21,40 +31,581 @@ const (
 
 	fileStorageFlagName    = "f"
 	defaultFileStoragePath = "/tmp/short-url-db.json"
-	fileStorageFlagUsage
+	fileStorageFlagUsage   = "Path to the file storage"
+
+	auditLogFlagName    = "audit-log"
+	defaultAuditLogPath = "/tmp/short-url-audit.jsonl"
+	auditLogFlagUsage   = "Path to the append-only audit log of link changes; kept in memory only if empty"
+
+	trustedSubnetFlagName  = "t"
+	trustedSubnetFlagUsage = "CIDR of the subnet allowed to call admin endpoints"
+
+	trustedProxiesFlagName  = "trusted-proxies"
+	trustedProxiesFlagUsage = "Comma-separated CIDRs of reverse proxies whose X-Real-IP header is trusted"
+
+	configFlagName  = "c"
+	configFlagUsage = "Path to the JSON config file"
+
+	traceExporterFlagName  = "trace-exporter"
+	traceExporterFlagUsage = "Span exporter: none, stdout or otlp"
+
+	compressionLevelFlagName  = "compression-level"
+	defaultCompressionLevel   = -1
+	compressionLevelFlagUsage = "Compression level from 1 (fastest) to 9 (smallest), -1 for default"
+
+	compressionMinSizeFlagName  = "compression-min-size"
+	defaultCompressionMinSize   = 256
+	compressionMinSizeFlagUsage = "Minimum response size in bytes to compress"
+
+	maxBodySizeFlagName  = "max-body-size"
+	defaultMaxBodySize   = 1 << 20
+	maxBodySizeFlagUsage = "Maximum request body size in bytes before decompression"
+
+	maxDecompressedSizeFlagName  = "max-decompressed-size"
+	defaultMaxDecompressedSize   = 10 << 20
+	maxDecompressedSizeFlagUsage = "Maximum request body size in bytes after decompression"
+
+	maxURLLengthFlagName  = "max-url-length"
+	defaultMaxURLLength   = 8192
+	maxURLLengthFlagUsage = "Maximum length of a URL to shorten"
+
+	allowedSchemesFlagName  = "allowed-schemes"
+	defaultAllowedSchemes   = "http,https"
+	allowedSchemesFlagUsage = "Comma-separated URL schemes allowed for shortening"
+
+	stripFragmentFlagName  = "strip-fragment"
+	stripFragmentFlagUsage = "Remove #fragment from URLs before shortening"
+
+	sortQueryFlagName  = "sort-query"
+	sortQueryFlagUsage = "Sort query parameters of URLs before shortening"
+
+	ownDomainsFlagName  = "own-domains"
+	ownDomainsFlagUsage = "Comma-separated extra hosts that also serve short links"
+
+	flattenChainsFlagName  = "flatten-chains"
+	flattenChainsFlagUsage = "Replace links to our own short links with their final destination instead of rejecting them"
+
+	blocklistFlagName  = "blocklist"
+	blocklistFlagUsage = "Path to the destination blocklist file"
+
+	redirectStatusFlagName  = "redirect-status"
+	defaultRedirectStatus   = 307
+	redirectStatusFlagUsage = "Default redirect status code: 301, 302, 307 or 308"
+
+	permanentRedirectMaxAgeFlagName  = "permanent-redirect-max-age"
+	defaultPermanentRedirectMaxAge   = 300
+	maxPermanentRedirectMaxAge       = 3600
+	permanentRedirectMaxAgeFlagUsage = "Seconds browsers and CDNs may cache permanent (301, 308) redirects, at most 3600; edits and blocklist changes reach cached clients only after it expires"
+
+	geoIPFlagName  = "geoip"
+	geoIPFlagUsage = "Path to the CSV database of IP ranges and countries"
+
+	inactivePageFlagName  = "inactive-page"
+	inactivePageFlagUsage = "Path to the HTML template shown for links that are not active yet; 404 without a page if empty"
+
+	linkPasswordMaxFailuresFlagName  = "link-password-max-failures"
+	defaultLinkPasswordMaxFailures   = 50
+	linkPasswordMaxFailuresFlagUsage = "Wrong passwords from all clients after which a protected link stops accepting passwords for 15 minutes; 0 disables the per-link lockout"
+
+	cookieSecretFlagName  = "cookie-secret"
+	cookieSecretFlagUsage = "Key for signing access cookies of password-protected links; random on each start if empty"
+
+	otlpEndpointFlagName  = "otlp-endpoint"
+	otlpEndpointFlagUsage = "Base URL of the OTLP/HTTP collector, e.g. http://localhost:4318"
 )
 
-var (
-	Address     string
-	BaseURL     string
-	LogLevel    string
-	FileStorage string
+// Допустимые значения Config.TraceExporter.
+const (
+	TraceExporterNone   = "none"
+	TraceExporterStdout = "stdout"
+	TraceExporterOTLP   = "otlp"
 )
 
-func Init() {
-	flag.StringVar(&Address, hostFlagName, defaultPort, hostFlagUsage)
-	flag.StringVar(&BaseURL, baseURLFlagName, defaultEndpoint, baseURLFlagUsage)
-	flag.StringVar(&LogLevel, logLevelFlagName, defaultLogLevel, logLevelFlagUsage)
-	flag.StringVar(&FileStorage, fileStorageFlagName, defaultFileStoragePath, fileStorageFlagUsage)
+// Config содержит настройки сервиса, собранные из файла конфигурации,
+// флагов и переменных окружения.
+type Config struct {
+	Address       string `json:"server_address"`
+	BaseURL       string `json:"base_url"`
+	LogLevel      string `json:"log_level"`
+	FileStorage   string `json:"file_storage_path"`
+	AuditLogPath  string `json:"audit_log_path"`
+	TrustedSubnet string `json:"trusted_subnet"`
+	// TrustedProxies — подсети обратных прокси, которым разрешено передавать
+	// адрес клиента в X-Real-IP; от остальных заголовок игнорируется.
+	TrustedProxies []string `json:"trusted_proxies"`
+	TraceExporter  string   `json:"trace_exporter"`
+	OTLPEndpoint   string   `json:"otlp_endpoint"`
+
+	CompressionLevel   int `json:"compression_level"`
+	CompressionMinSize int `json:"compression_min_size"`
+
+	MaxBodySize         int64 `json:"max_body_size"`
+	MaxDecompressedSize int64 `json:"max_decompressed_size"`
+	MaxURLLength        int   `json:"max_url_length"`
+
+	AllowedSchemes []string `json:"allowed_schemes"`
+	StripFragment  bool     `json:"strip_fragment"`
+	SortQuery      bool     `json:"sort_query"`
+
+	BlocklistPath string `json:"blocklist_path"`
+	GeoIPPath     string `json:"geoip_path"`
+	// InactivePagePath — шаблон страницы для ссылок, которые ещё не начали действовать.
+	InactivePagePath string `json:"inactive_page"`
+
+	OwnDomains    []string `json:"own_domains"`
+	FlattenChains bool     `json:"flatten_chains"`
+
+	// RedirectStatus — код редиректа для ссылок, у которых он не задан.
+	RedirectStatus int `json:"redirect_status"`
+	// PermanentRedirectMaxAge — сколько секунд кэшируются постоянные редиректы.
+	// Пока кэш не истёк, клиенты не видят правок ссылки и новых правил
+	// блокировки, поэтому значение ограничено часом.
+	PermanentRedirectMaxAge int `json:"permanent_redirect_max_age"`
+
+	// CookieSecret — ключ подписи cookie доступа к ссылкам с паролем.
+	CookieSecret string `json:"cookie_secret"`
+	// LinkPasswordMaxFailures — сколько неверных паролей со всех адресов
+	// вместе закрывают форму ссылки на 15 минут; 0 — без такой блокировки.
+	// Блокировка ограничивает перебор с множества адресов, но любой может
+	// ею закрыть ссылку для посетителей, ещё не вводивших пароль. Посетители
+	// с действующей cookie доступа её не замечают.
+	LinkPasswordMaxFailures int `json:"link_password_max_failures"`
+
+	// ConfigPath — путь к файлу, из которого была прочитана конфигурация.
+	// Нужен для перечитывания файла по SIGHUP.
+	ConfigPath string `json:"-"`
+}
+
+// Default возвращает конфигурацию со значениями по умолчанию.
+func Default() *Config {
+	return &Config{
+		Address:       defaultPort,
+		BaseURL:       defaultEndpoint,
+		LogLevel:      defaultLogLevel,
+		FileStorage:   defaultFileStoragePath,
+		AuditLogPath:  defaultAuditLogPath,
+		TraceExporter: TraceExporterNone,
+
+		CompressionLevel:   defaultCompressionLevel,
+		CompressionMinSize: defaultCompressionMinSize,
+
+		MaxBodySize:         defaultMaxBodySize,
+		MaxDecompressedSize: defaultMaxDecompressedSize,
+		MaxURLLength:        defaultMaxURLLength,
 
-	flag.Parse()
+		AllowedSchemes: splitList(defaultAllowedSchemes),
 
-	if envRunHostAddr := os.Getenv("HOST_ADDRESS"); envRunHostAddr != "" {
-		Address = envRunHostAddr
+		RedirectStatus:          defaultRedirectStatus,
+		PermanentRedirectMaxAge: defaultPermanentRedirectMaxAge,
+
+		LinkPasswordMaxFailures: defaultLinkPasswordMaxFailures,
 	}
-	if envRunBaseURL := os.Getenv("BASE_URL"); envRunBaseURL != "" {
-		BaseURL = envRunBaseURL
+}
+
+// IsRedirectStatus сообщает, можно ли использовать code как код редиректа короткой ссылки.
+func IsRedirectStatus(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
 	}
-	if envRunLogLevel := os.Getenv("LOG_LEVEL"); envRunLogLevel != "" {
-		LogLevel = envRunLogLevel
+	return false
+}
+
+// splitList разбирает список через запятую, отбрасывая пустые элементы.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			items = append(items, item)
+		}
 	}
-	if envRunFileStorage := os.Getenv("FILE_STORAGE_PATH"); envRunFileStorage != "" {
-		FileStorage = envRunFileStorage
+	return items
+}
+
+// Load разбирает файл конфигурации, аргументы командной строки и переменные окружения.
+// Приоритет по возрастанию: значения по умолчанию, файл, флаги, переменные окружения.
+// Все ошибки валидации возвращаются одной агрегированной ошибкой.
+func Load(args []string, getenv func(string) string) (*Config, error) {
+	var flags Config
+
+	fs := flag.NewFlagSet("shortener", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&flags.Address, hostFlagName, defaultPort, hostFlagUsage)
+	fs.StringVar(&flags.BaseURL, baseURLFlagName, defaultEndpoint, baseURLFlagUsage)
+	fs.StringVar(&flags.LogLevel, logLevelFlagName, defaultLogLevel, logLevelFlagUsage)
+	fs.StringVar(&flags.FileStorage, fileStorageFlagName, defaultFileStoragePath, fileStorageFlagUsage)
+	fs.StringVar(&flags.AuditLogPath, auditLogFlagName, defaultAuditLogPath, auditLogFlagUsage)
+	fs.StringVar(&flags.TrustedSubnet, trustedSubnetFlagName, "", trustedSubnetFlagUsage)
+	fs.Func(trustedProxiesFlagName, trustedProxiesFlagUsage, func(s string) error {
+		flags.TrustedProxies = splitList(s)
+		return nil
+	})
+	fs.StringVar(&flags.ConfigPath, configFlagName, "", configFlagUsage)
+	fs.StringVar(&flags.TraceExporter, traceExporterFlagName, TraceExporterNone, traceExporterFlagUsage)
+	fs.StringVar(&flags.OTLPEndpoint, otlpEndpointFlagName, "", otlpEndpointFlagUsage)
+	fs.IntVar(&flags.CompressionLevel, compressionLevelFlagName, defaultCompressionLevel, compressionLevelFlagUsage)
+	fs.IntVar(&flags.CompressionMinSize, compressionMinSizeFlagName, defaultCompressionMinSize, compressionMinSizeFlagUsage)
+	fs.Int64Var(&flags.MaxBodySize, maxBodySizeFlagName, defaultMaxBodySize, maxBodySizeFlagUsage)
+	fs.Int64Var(&flags.MaxDecompressedSize, maxDecompressedSizeFlagName, defaultMaxDecompressedSize, maxDecompressedSizeFlagUsage)
+	fs.IntVar(&flags.MaxURLLength, maxURLLengthFlagName, defaultMaxURLLength, maxURLLengthFlagUsage)
+	fs.Func(allowedSchemesFlagName, allowedSchemesFlagUsage, func(s string) error {
+		flags.AllowedSchemes = splitList(s)
+		return nil
+	})
+	fs.BoolVar(&flags.StripFragment, stripFragmentFlagName, false, stripFragmentFlagUsage)
+	fs.BoolVar(&flags.SortQuery, sortQueryFlagName, false, sortQueryFlagUsage)
+	fs.StringVar(&flags.BlocklistPath, blocklistFlagName, "", blocklistFlagUsage)
+	fs.StringVar(&flags.GeoIPPath, geoIPFlagName, "", geoIPFlagUsage)
+	fs.StringVar(&flags.InactivePagePath, inactivePageFlagName, "", inactivePageFlagUsage)
+	fs.StringVar(&flags.CookieSecret, cookieSecretFlagName, "", cookieSecretFlagUsage)
+	fs.IntVar(&flags.LinkPasswordMaxFailures, linkPasswordMaxFailuresFlagName, defaultLinkPasswordMaxFailures, linkPasswordMaxFailuresFlagUsage)
+	fs.Func(ownDomainsFlagName, ownDomainsFlagUsage, func(s string) error {
+		flags.OwnDomains = splitList(s)
+		return nil
+	})
+	fs.BoolVar(&flags.FlattenChains, flattenChainsFlagName, false, flattenChainsFlagUsage)
+	fs.IntVar(&flags.RedirectStatus, redirectStatusFlagName, defaultRedirectStatus, redirectStatusFlagUsage)
+	fs.IntVar(&flags.PermanentRedirectMaxAge, permanentRedirectMaxAgeFlagName, defaultPermanentRedirectMaxAge, permanentRedirectMaxAgeFlagUsage)
+
+	if err := fs.Parse(args); err != nil {
+		return nil, fmt.Errorf("parse flags: %w", err)
+	}
+
+	cfg := Default()
+
+	cfg.ConfigPath = flags.ConfigPath
+	if envConfig := getenv("CONFIG"); envConfig != "" {
+		cfg.ConfigPath = envConfig
+	}
+	if cfg.ConfigPath != "" {
+		if err := cfg.loadFile(cfg.ConfigPath); err != nil {
+			return nil, err
+		}
+	}
+
+	// Флаги перекрывают файл, только если они заданы явно
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case hostFlagName:
+			cfg.Address = flags.Address
+		case baseURLFlagName:
+			cfg.BaseURL = flags.BaseURL
+		case logLevelFlagName:
+			cfg.LogLevel = flags.LogLevel
+		case fileStorageFlagName:
+			cfg.FileStorage = flags.FileStorage
+		case auditLogFlagName:
+			cfg.AuditLogPath = flags.AuditLogPath
+		case trustedSubnetFlagName:
+			cfg.TrustedSubnet = flags.TrustedSubnet
+		case trustedProxiesFlagName:
+			cfg.TrustedProxies = flags.TrustedProxies
+		case traceExporterFlagName:
+			cfg.TraceExporter = flags.TraceExporter
+		case otlpEndpointFlagName:
+			cfg.OTLPEndpoint = flags.OTLPEndpoint
+		case compressionLevelFlagName:
+			cfg.CompressionLevel = flags.CompressionLevel
+		case compressionMinSizeFlagName:
+			cfg.CompressionMinSize = flags.CompressionMinSize
+		case maxBodySizeFlagName:
+			cfg.MaxBodySize = flags.MaxBodySize
+		case maxDecompressedSizeFlagName:
+			cfg.MaxDecompressedSize = flags.MaxDecompressedSize
+		case maxURLLengthFlagName:
+			cfg.MaxURLLength = flags.MaxURLLength
+		case allowedSchemesFlagName:
+			cfg.AllowedSchemes = flags.AllowedSchemes
+		case stripFragmentFlagName:
+			cfg.StripFragment = flags.StripFragment
+		case sortQueryFlagName:
+			cfg.SortQuery = flags.SortQuery
+		case blocklistFlagName:
+			cfg.BlocklistPath = flags.BlocklistPath
+		case geoIPFlagName:
+			cfg.GeoIPPath = flags.GeoIPPath
+		case inactivePageFlagName:
+			cfg.InactivePagePath = flags.InactivePagePath
+		case cookieSecretFlagName:
+			cfg.CookieSecret = flags.CookieSecret
+		case linkPasswordMaxFailuresFlagName:
+			cfg.LinkPasswordMaxFailures = flags.LinkPasswordMaxFailures
+		case ownDomainsFlagName:
+			cfg.OwnDomains = flags.OwnDomains
+		case flattenChainsFlagName:
+			cfg.FlattenChains = flags.FlattenChains
+		case redirectStatusFlagName:
+			cfg.RedirectStatus = flags.RedirectStatus
+		case permanentRedirectMaxAgeFlagName:
+			cfg.PermanentRedirectMaxAge = flags.PermanentRedirectMaxAge
+		}
+	})
+
+	if envRunHostAddr := getenv("HOST_ADDRESS"); envRunHostAddr != "" {
+		cfg.Address = envRunHostAddr
+	}
+	if envRunBaseURL := getenv("BASE_URL"); envRunBaseURL != "" {
+		cfg.BaseURL = envRunBaseURL
+	}
+	if envRunLogLevel := getenv("LOG_LEVEL"); envRunLogLevel != "" {
+		cfg.LogLevel = envRunLogLevel
+	}
+	if envRunFileStorage := getenv("FILE_STORAGE_PATH"); envRunFileStorage != "" {
+		cfg.FileStorage = envRunFileStorage
+	}
+	if envAuditLog := getenv("AUDIT_LOG_PATH"); envAuditLog != "" {
+		cfg.AuditLogPath = envAuditLog
+	}
+	if envTrustedSubnet := getenv("TRUSTED_SUBNET"); envTrustedSubnet != "" {
+		cfg.TrustedSubnet = envTrustedSubnet
+	}
+	if envTrustedProxies := getenv("TRUSTED_PROXIES"); envTrustedProxies != "" {
+		cfg.TrustedProxies = splitList(envTrustedProxies)
+	}
+	if envOwnDomains := getenv("OWN_DOMAINS"); envOwnDomains != "" {
+		cfg.OwnDomains = splitList(envOwnDomains)
+	}
+	if envBlocklist := getenv("BLOCKLIST_PATH"); envBlocklist != "" {
+		cfg.BlocklistPath = envBlocklist
+	}
+	if envGeoIP := getenv("GEOIP_PATH"); envGeoIP != "" {
+		cfg.GeoIPPath = envGeoIP
+	}
+	if envInactivePage := getenv("INACTIVE_PAGE"); envInactivePage != "" {
+		cfg.InactivePagePath = envInactivePage
+	}
+	if envCookieSecret := getenv("COOKIE_SECRET"); envCookieSecret != "" {
+		cfg.CookieSecret = envCookieSecret
+	}
+	if envTraceExporter := getenv("TRACE_EXPORTER"); envTraceExporter != "" {
+		cfg.TraceExporter = envTraceExporter
+	}
+	if envOTLPEndpoint := getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); envOTLPEndpoint != "" {
+		cfg.OTLPEndpoint = envOTLPEndpoint
+	}
+
+	var errs []error
+	intEnv := func(name string, dst *int64) {
+		if v := getenv(name); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				return
+			}
+			*dst = n
+		}
+	}
+
+	compressionLevel := int64(cfg.CompressionLevel)
+	intEnv("COMPRESSION_LEVEL", &compressionLevel)
+	cfg.CompressionLevel = int(compressionLevel)
+
+	compressionMinSize := int64(cfg.CompressionMinSize)
+	intEnv("COMPRESSION_MIN_SIZE", &compressionMinSize)
+	cfg.CompressionMinSize = int(compressionMinSize)
+
+	intEnv("MAX_BODY_SIZE", &cfg.MaxBodySize)
+	intEnv("MAX_DECOMPRESSED_SIZE", &cfg.MaxDecompressedSize)
+
+	maxURLLength := int64(cfg.MaxURLLength)
+	intEnv("MAX_URL_LENGTH", &maxURLLength)
+	cfg.MaxURLLength = int(maxURLLength)
+
+	redirectStatus := int64(cfg.RedirectStatus)
+	intEnv("REDIRECT_STATUS", &redirectStatus)
+	cfg.RedirectStatus = int(redirectStatus)
+
+	permanentRedirectMaxAge := int64(cfg.PermanentRedirectMaxAge)
+	intEnv("PERMANENT_REDIRECT_MAX_AGE", &permanentRedirectMaxAge)
+	cfg.PermanentRedirectMaxAge = int(permanentRedirectMaxAge)
+
+	linkPasswordMaxFailures := int64(cfg.LinkPasswordMaxFailures)
+	intEnv("LINK_PASSWORD_MAX_FAILURES", &linkPasswordMaxFailures)
+	cfg.LinkPasswordMaxFailures = int(linkPasswordMaxFailures)
+
+	boolEnv := func(name string, dst *bool) {
+		if v := getenv(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				return
+			}
+			*dst = b
+		}
+	}
+	boolEnv("STRIP_FRAGMENT", &cfg.StripFragment)
+	boolEnv("SORT_QUERY", &cfg.SortQuery)
+	boolEnv("FLATTEN_CHAINS", &cfg.FlattenChains)
+
+	if envAllowedSchemes := getenv("ALLOWED_SCHEMES"); envAllowedSchemes != "" {
+		cfg.AllowedSchemes = splitList(envAllowedSchemes)
 	}
 
 	// Убедиться, что baseURL заканчивается на /
-	if !strings.HasSuffix(BaseURL, "/") {
-		BaseURL += "/"
+	if !strings.HasSuffix(cfg.BaseURL, "/") {
+		cfg.BaseURL += "/"
+	}
+
+	if err := errors.Join(append(errs, cfg.Validate())...); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("parse config file %q: %w", path, err)
+	}
+	return nil
+}
+
+// Validate проверяет все поля конфигурации и возвращает все найденные ошибки разом.
+func (c *Config) Validate() error {
+	var errs []error
+
+	if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		errs = append(errs, fmt.Errorf("address %q: %w", c.Address, err))
+	}
+
+	if u, err := url.Parse(c.BaseURL); err != nil {
+		errs = append(errs, fmt.Errorf("base URL %q: %w", c.BaseURL, err))
+	} else if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Errorf("base URL %q: must be an absolute http(s) URL", c.BaseURL))
+	}
+
+	if _, err := zap.ParseAtomicLevel(c.LogLevel); err != nil {
+		errs = append(errs, fmt.Errorf("log level %q: %w", c.LogLevel, err))
+	}
+
+	if c.FileStorage == "" {
+		errs = append(errs, errors.New("file storage path must not be empty"))
+	} else if strings.HasSuffix(c.FileStorage, string(filepath.Separator)) {
+		errs = append(errs, fmt.Errorf("file storage path %q: must be a file, not a directory", c.FileStorage))
+	}
+	if strings.HasSuffix(c.AuditLogPath, string(filepath.Separator)) {
+		errs = append(errs, fmt.Errorf("audit log path %q: must be a file, not a directory", c.AuditLogPath))
+	}
+
+	if c.TrustedSubnet != "" {
+		if _, _, err := net.ParseCIDR(c.TrustedSubnet); err != nil {
+			errs = append(errs, fmt.Errorf("trusted subnet %q: %w", c.TrustedSubnet, err))
+		}
+	}
+	for _, cidr := range c.TrustedProxies {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			errs = append(errs, fmt.Errorf("trusted proxy %q: %w", cidr, err))
+		}
 	}
 
+	if c.CompressionLevel != -1 && (c.CompressionLevel < 1 || c.CompressionLevel > 9) {
+		errs = append(errs, fmt.Errorf("compression level %d: must be -1 or between 1 and 9", c.CompressionLevel))
+	}
+	if c.CompressionMinSize < 0 {
+		errs = append(errs, fmt.Errorf("compression min size %d: must not be negative", c.CompressionMinSize))
+	}
+
+	if c.MaxBodySize <= 0 {
+		errs = append(errs, fmt.Errorf("max body size %d: must be positive", c.MaxBodySize))
+	}
+	if c.MaxDecompressedSize <= 0 {
+		errs = append(errs, fmt.Errorf("max decompressed size %d: must be positive", c.MaxDecompressedSize))
+	}
+	if c.MaxURLLength <= 0 {
+		errs = append(errs, fmt.Errorf("max URL length %d: must be positive", c.MaxURLLength))
+	}
+
+	if len(c.AllowedSchemes) == 0 {
+		errs = append(errs, errors.New("allowed schemes must not be empty"))
+	}
+
+	if !IsRedirectStatus(c.RedirectStatus) {
+		errs = append(errs, fmt.Errorf("redirect status %d: must be one of 301, 302, 307, 308", c.RedirectStatus))
+	}
+	if c.PermanentRedirectMaxAge < 0 || c.PermanentRedirectMaxAge > maxPermanentRedirectMaxAge {
+		errs = append(errs, fmt.Errorf("permanent redirect max age %d: must be between 0 and %d", c.PermanentRedirectMaxAge, maxPermanentRedirectMaxAge))
+	}
+
+	if c.LinkPasswordMaxFailures < 0 {
+		errs = append(errs, fmt.Errorf("link password max failures %d: must not be negative", c.LinkPasswordMaxFailures))
+	}
+
+	switch c.TraceExporter {
+	case TraceExporterNone, TraceExporterStdout:
+	case TraceExporterOTLP:
+		if u, err := url.Parse(c.OTLPEndpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("otlp endpoint %q: must be an absolute URL", c.OTLPEndpoint))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("trace exporter %q: must be one of none, stdout, otlp", c.TraceExporter))
+	}
+
+	return errors.Join(errs...)
+}
+
+// RestartRequired возвращает имена настроек, которые отличаются в next,
+// но не могут быть применены без перезапуска сервиса.
+func (c *Config) RestartRequired(next *Config) []string {
+	var fields []string
+	if c.Address != next.Address {
+		fields = append(fields, "server_address")
+	}
+	if c.BaseURL != next.BaseURL {
+		fields = append(fields, "base_url")
+	}
+	if c.FileStorage != next.FileStorage {
+		fields = append(fields, "file_storage_path")
+	}
+	if c.AuditLogPath != next.AuditLogPath {
+		fields = append(fields, "audit_log_path")
+	}
+	if c.TraceExporter != next.TraceExporter || c.OTLPEndpoint != next.OTLPEndpoint {
+		fields = append(fields, "trace_exporter")
+	}
+	if c.CompressionLevel != next.CompressionLevel || c.CompressionMinSize != next.CompressionMinSize {
+		fields = append(fields, "compression")
+	}
+	if c.MaxBodySize != next.MaxBodySize || c.MaxDecompressedSize != next.MaxDecompressedSize ||
+		c.MaxURLLength != next.MaxURLLength {
+		fields = append(fields, "limits")
+	}
+	if strings.Join(c.AllowedSchemes, ",") != strings.Join(next.AllowedSchemes, ",") ||
+		c.StripFragment != next.StripFragment || c.SortQuery != next.SortQuery {
+		fields = append(fields, "normalization")
+	}
+	if strings.Join(c.OwnDomains, ",") != strings.Join(next.OwnDomains, ",") || c.FlattenChains != next.FlattenChains {
+		fields = append(fields, "own_domains")
+	}
+	if c.RedirectStatus != next.RedirectStatus || c.PermanentRedirectMaxAge != next.PermanentRedirectMaxAge {
+		fields = append(fields, "redirect")
+	}
+	if c.CookieSecret != next.CookieSecret {
+		fields = append(fields, "cookie_secret")
+	}
+	if c.LinkPasswordMaxFailures != next.LinkPasswordMaxFailures {
+		fields = append(fields, "link_password_max_failures")
+	}
+	return fields
+}
+
+// Reloaded возвращает конфигурацию, которая действует после перечитывания
+// next: настройки из RestartRequired остаются прежними, остальные берутся из next.
+func (c *Config) Reloaded(next *Config) *Config {
+	applied := *next
+	applied.Address = c.Address
+	applied.BaseURL = c.BaseURL
+	applied.FileStorage = c.FileStorage
+	applied.AuditLogPath = c.AuditLogPath
+	applied.TraceExporter, applied.OTLPEndpoint = c.TraceExporter, c.OTLPEndpoint
+	applied.CompressionLevel, applied.CompressionMinSize = c.CompressionLevel, c.CompressionMinSize
+	applied.MaxBodySize, applied.MaxDecompressedSize, applied.MaxURLLength = c.MaxBodySize, c.MaxDecompressedSize, c.MaxURLLength
+	applied.AllowedSchemes, applied.StripFragment, applied.SortQuery = c.AllowedSchemes, c.StripFragment, c.SortQuery
+	applied.OwnDomains, applied.FlattenChains = c.OwnDomains, c.FlattenChains
+	applied.RedirectStatus, applied.PermanentRedirectMaxAge = c.RedirectStatus, c.PermanentRedirectMaxAge
+	applied.CookieSecret, applied.LinkPasswordMaxFailures = c.CookieSecret, c.LinkPasswordMaxFailures
+	return &applied
 }
@@ -0,0 +1,190 @@
+package config
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func envMap(m map[string]string) func(string) string {
+	return func(key string) string {
+		return m[key]
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		want    *Config
+		wantErr []string
+	}{
+		{
+			name: "defaults",
+			want: Default(),
+		},
+		{
+			name: "flags",
+			args: []string{"-a", "localhost:9090", "-b", "http://short.ly", "-l", "debug", "-f", "/tmp/db.json"},
+			want: &Config{
+				Address:       "localhost:9090",
+				BaseURL:       "http://short.ly/",
+				LogLevel:      "debug",
+				FileStorage:   "/tmp/db.json",
+				AuditLogPath:  defaultAuditLogPath,
+				TraceExporter: TraceExporterNone,
+
+				CompressionLevel:   defaultCompressionLevel,
+				CompressionMinSize: defaultCompressionMinSize,
+
+				MaxBodySize:         defaultMaxBodySize,
+				MaxDecompressedSize: defaultMaxDecompressedSize,
+				MaxURLLength:        defaultMaxURLLength,
+
+				AllowedSchemes: []string{"http", "https"},
+
+				RedirectStatus:          defaultRedirectStatus,
+				PermanentRedirectMaxAge: defaultPermanentRedirectMaxAge,
+
+				LinkPasswordMaxFailures: defaultLinkPasswordMaxFailures,
+			},
+		},
+		{
+			name: "env_overrides_flags",
+			args: []string{"-a", "localhost:9090"},
+			env: map[string]string{
+				"HOST_ADDRESS": ":7070",
+				"BASE_URL":     "https://s.example.com/",
+			},
+			want: &Config{
+				Address:       ":7070",
+				BaseURL:       "https://s.example.com/",
+				LogLevel:      defaultLogLevel,
+				FileStorage:   defaultFileStoragePath,
+				AuditLogPath:  defaultAuditLogPath,
+				TraceExporter: TraceExporterNone,
+
+				CompressionLevel:   defaultCompressionLevel,
+				CompressionMinSize: defaultCompressionMinSize,
+
+				MaxBodySize:         defaultMaxBodySize,
+				MaxDecompressedSize: defaultMaxDecompressedSize,
+				MaxURLLength:        defaultMaxURLLength,
+
+				AllowedSchemes: []string{"http", "https"},
+
+				RedirectStatus:          defaultRedirectStatus,
+				PermanentRedirectMaxAge: defaultPermanentRedirectMaxAge,
+
+				LinkPasswordMaxFailures: defaultLinkPasswordMaxFailures,
+			},
+		},
+		{
+			name: "normalization",
+			args: []string{"-allowed-schemes", "HTTPS, ftp", "-strip-fragment", "-geoip", "/tmp/flag.csv"},
+			env:  map[string]string{"SORT_QUERY": "true", "GEOIP_PATH": "/tmp/env.csv"},
+			want: func() *Config {
+				c := Default()
+				c.AllowedSchemes = []string{"https", "ftp"}
+				c.StripFragment = true
+				c.SortQuery = true
+				c.GeoIPPath = "/tmp/env.csv"
+				return c
+			}(),
+		},
+		{
+			name: "redirect",
+			args: []string{"-redirect-status", "301"},
+			env:  map[string]string{"PERMANENT_REDIRECT_MAX_AGE": "600"},
+			want: func() *Config {
+				c := Default()
+				c.RedirectStatus = 301
+				c.PermanentRedirectMaxAge = 600
+				return c
+			}(),
+		},
+		{
+			name: "inactive_page",
+			args: []string{"-inactive-page", "/tmp/soon.html"},
+			want: func() *Config {
+				c := Default()
+				c.InactivePagePath = "/tmp/soon.html"
+				return c
+			}(),
+		},
+		{
+			name: "trusted_proxies",
+			args: []string{"-trusted-proxies", "10.0.0.0/8, ::1/128"},
+			want: func() *Config {
+				c := Default()
+				c.TrustedProxies = []string{"10.0.0.0/8", "::1/128"}
+				return c
+			}(),
+		},
+		{
+			name: "audit_log_memory_only",
+			args: []string{"-audit-log", ""},
+			want: func() *Config {
+				c := Default()
+				c.AuditLogPath = ""
+				return c
+			}(),
+		},
+		{
+			name: "cookie_secret",
+			args: []string{"-cookie-secret", "flag"},
+			env:  map[string]string{"COOKIE_SECRET": "env"},
+			want: func() *Config {
+				c := Default()
+				c.CookieSecret = "env"
+				return c
+			}(),
+		},
+		{
+			name: "link_password_max_failures",
+			args: []string{"-link-password-max-failures", "10"},
+			env:  map[string]string{"LINK_PASSWORD_MAX_FAILURES": "0"},
+			want: func() *Config {
+				c := Default()
+				c.LinkPasswordMaxFailures = 0
+				return c
+			}(),
+		},
+		{
+			name:    "link_password_max_failures_negative",
+			args:    []string{"-link-password-max-failures", "-1"},
+			wantErr: []string{"link password max failures -1: must not be negative"},
+		},
+		{
+			name:    "aggregated_errors",
+			args:    []string{"-a", "nope", "-b", "ftp://x", "-l", "loud", "-f", "/tmp/", "-audit-log", "/var/log/", "-trusted-proxies", "10.0.0.1", "-compression-level", "12"},
+			env:     map[string]string{"COMPRESSION_MIN_SIZE": "big", "MAX_BODY_SIZE": "0", "REDIRECT_STATUS": "303"},
+			wantErr: []string{"address", "base URL", "log level", "file storage", "audit log", "trusted proxy", "compression level", "COMPRESSION_MIN_SIZE", "max body size", "redirect status"},
+		},
+		{
+			name:    "permanent_redirect_max_age_too_long",
+			env:     map[string]string{"PERMANENT_REDIRECT_MAX_AGE": "86400"},
+			wantErr: []string{"permanent redirect max age 86400: must be between 0 and 3600"},
+		},
+		{
+			name:    "unknown_flag",
+			args:    []string{"-z"},
+			wantErr: []string{"parse flags"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Load(tt.args, envMap(tt.env))
+			if len(tt.wantErr) > 0 {
+				require.Error(t, err)
+				for _, msg := range tt.wantErr {
+					assert.Contains(t, err.Error(), msg)
+				}
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, cfg)
+		})
+	}
+}
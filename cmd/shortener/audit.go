@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ivanlp-p/ShortLinkService/cmd/config"
+	"github.com/ivanlp-p/ShortLinkService/internal/audit"
+	"github.com/ivanlp-p/ShortLinkService/internal/logger"
+	"github.com/ivanlp-p/ShortLinkService/internal/models"
+	"go.uber.org/zap"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// recordAudit записывает изменение ссылки в журнал аудита. before равен nil
+// для новой ссылки. Адрес клиента берётся из clientIP, которому клиент не
+// может подсунуть свой X-Real-IP. Ошибка записи журнала логируется, но не
+// отменяет уже сохранённое изменение.
+func recordAudit(r *http.Request, al *audit.Log, cfg *config.Config, action string, before *models.ShortLink, after models.ShortLink) {
+	entry := audit.Entry{
+		Actor:     actor(r),
+		Action:    action,
+		LinkID:    after.ShortURL,
+		RequestID: logger.RequestID(r.Context()),
+	}
+	if before != nil {
+		info := linkInfo(cfg, *before)
+		entry.Before = &info
+	}
+	info := linkInfo(cfg, after)
+	entry.After = &info
+	if ip := clientIP(r); ip != nil {
+		entry.ClientIP = ip.String()
+	}
+	if err := al.Record(entry); err != nil {
+		logger.FromContext(r.Context()).Error("Audit log write failed",
+			zap.String("id", after.ShortURL), zap.String("action", action), zap.Error(err))
+	}
+}
+
+// parseAuditFilter разбирает фильтр из параметров запроса:
+// actor, action, link, since и until (RFC 3339), limit.
+func parseAuditFilter(query url.Values) (audit.Filter, error) {
+	f := audit.Filter{
+		Actor:  query.Get("actor"),
+		Action: query.Get("action"),
+		LinkID: query.Get("link"),
+	}
+	for name, dst := range map[string]*time.Time{"since": &f.Since, "until": &f.Until} {
+		if v := query.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return audit.Filter{}, fmt.Errorf("%s: must be an RFC 3339 time", name)
+			}
+			*dst = t
+		}
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			return audit.Filter{}, fmt.Errorf("limit %q: must be a non-negative integer", v)
+		}
+		f.Limit = limit
+	}
+	return f, nil
+}
+
+// handlerAudit возвращает записи журнала аудита, подходящие под фильтр.
+func handlerAudit(al *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		f, err := parseAuditFilter(r.URL.Query())
+		if err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		entries := al.Query(f)
+		if entries == nil {
+			entries = []audit.Entry{}
+		}
+		response, err := json.MarshalIndent(entries, "", "   ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(response)
+	}
+}
+
+// handlerAuditExport выгружает записи журнала аудита в формате JSONL.
+func handlerAuditExport(al *audit.Log) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		f, err := parseAuditFilter(r.URL.Query())
+		if err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="audit.jsonl"`)
+		w.WriteHeader(http.StatusOK)
+		if err := al.Export(w, f); err != nil {
+			logger.FromContext(r.Context()).Error("Audit export failed", zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/ivanlp-p/ShortLinkService/cmd/config"
+	"github.com/ivanlp-p/ShortLinkService/internal/audit"
+	"github.com/ivanlp-p/ShortLinkService/internal/auth"
+	"github.com/ivanlp-p/ShortLinkService/internal/logger"
+	"github.com/ivanlp-p/ShortLinkService/internal/models"
+	"github.com/ivanlp-p/ShortLinkService/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_audit(t *testing.T) {
+	cfg := config.Default()
+	cfg.TrustedProxies = []string{"10.0.0.0/8"}
+	rl := newReloader(cfg, nil, nil)
+	dir := t.TempDir()
+	fileStorage := storage.NewFileStorage(filepath.Join(dir, "db.json"), storage.NewMapStorage())
+	bl := noBlocklist(t)
+	auditPath := filepath.Join(dir, "audit.jsonl")
+	al, err := audit.Open(auditPath)
+	require.NoError(t, err)
+	authn := auth.New([]byte("key"))
+	alice := authn.Cookie("alice")
+
+	router := chi.NewRouter()
+	router.Use(func(h http.Handler) http.Handler { return logger.RequestLogger(rl.realIP(h.ServeHTTP)) })
+	router.Post("/api/shorten", authn.Handler(PostShortenRequest(cfg, fileStorage, bl, al)))
+	router.Patch("/api/links/{id}", authn.Handler(handlerPatch(cfg, fileStorage, bl, al)))
+	router.Put("/api/links/{id}/targeting", handlerTargeting(cfg, fileStorage, bl, al))
+	router.Get("/api/internal/audit", handlerAudit(al))
+	router.Get("/api/internal/audit/export", handlerAuditExport(al))
+
+	sendFrom := func(remoteAddr, realIP, method, target, body, requestID string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		request.Header.Set("If-Match", "*")
+		if remoteAddr != "" {
+			request.RemoteAddr = remoteAddr
+		}
+		if realIP != "" {
+			request.Header.Set("X-Real-IP", realIP)
+		}
+		if requestID != "" {
+			request.Header.Set(logger.RequestIDHeader, requestID)
+		}
+		if cookie != nil {
+			request.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w
+	}
+	send := func(method, target, body, requestID string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		return sendFrom("", "", method, target, body, requestID, cookie)
+	}
+
+	w := sendFrom("10.0.0.5:1234", "198.51.100.20", http.MethodPost, "/api/shorten", `{"url": "https://example.com/v1"}`, "req-create", alice)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var resp models.ShortURL
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	id := strings.TrimPrefix(resp.Result, cfg.BaseURL)
+
+	require.Equal(t, http.StatusOK, send(http.MethodPatch, "/api/links/"+id, `{"url": "https://example.com/v2"}`, "req-update", alice).Code)
+	w = sendFrom("", "10.0.0.1", http.MethodPut, "/api/links/"+id+"/targeting", `{"country": [{"countries": ["DE"], "url": "https://example.de/de"}]}`, "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, http.StatusBadRequest, send(http.MethodPatch, "/api/links/"+id, `{"url": "javascript:alert(1)"}`, "", alice).Code)
+
+	query := func(t *testing.T, target string) []audit.Entry {
+		t.Helper()
+		w := send(http.MethodGet, target, "", "", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var entries []audit.Entry
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+		return entries
+	}
+
+	t.Run("entries", func(t *testing.T) {
+		entries := query(t, "/api/internal/audit")
+		require.Len(t, entries, 3, "failed changes must not be recorded")
+
+		create, update, targeting := entries[0], entries[1], entries[2]
+		assert.Equal(t, audit.ActionCreate, create.Action)
+		assert.Equal(t, "alice", create.Actor)
+		assert.Equal(t, id, create.LinkID)
+		assert.Equal(t, "req-create", create.RequestID)
+		assert.Equal(t, "198.51.100.20", create.ClientIP, "client address from a trusted proxy")
+		assert.Nil(t, create.Before)
+		require.NotNil(t, create.After)
+		assert.Equal(t, "https://example.com/v1", create.After.URL)
+
+		assert.Equal(t, audit.ActionUpdate, update.Action)
+		assert.Equal(t, "req-update", update.RequestID)
+		require.NotNil(t, update.Before)
+		assert.Equal(t, "https://example.com/v1", update.Before.URL)
+		assert.Equal(t, "https://example.com/v2", update.After.URL)
+		assert.Equal(t, 2, update.After.Version)
+
+		assert.Equal(t, audit.ActionTargeting, targeting.Action)
+		assert.Equal(t, "admin:192.0.2.1", targeting.Actor, "X-Real-IP from a client is ignored")
+		assert.Equal(t, "192.0.2.1", targeting.ClientIP)
+		assert.NotEmpty(t, targeting.RequestID, "generated request ID")
+		assert.Nil(t, targeting.Before.Targeting)
+		assert.Equal(t, "https://example.de/de", targeting.After.Targeting.Country[0].URL)
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		tests := []struct {
+			name            string
+			target          string
+			expectedActions []string
+		}{
+			{name: "actor", target: "/api/internal/audit?actor=alice", expectedActions: []string{"create", "update"}},
+			{name: "action", target: "/api/internal/audit?action=targeting", expectedActions: []string{"targeting"}},
+			{name: "link", target: "/api/internal/audit?link=missing", expectedActions: []string{}},
+			{name: "limit", target: "/api/internal/audit?limit=1", expectedActions: []string{"targeting"}},
+			{name: "until", target: "/api/internal/audit?until=2000-01-01T00:00:00Z", expectedActions: []string{}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				actions := []string{}
+				for _, e := range query(t, tt.target) {
+					actions = append(actions, e.Action)
+				}
+				assert.Equal(t, tt.expectedActions, actions)
+			})
+		}
+
+		w := send(http.MethodGet, "/api/internal/audit?since=yesterday", "", "", nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "since")
+	})
+
+	t.Run("export", func(t *testing.T) {
+		w := send(http.MethodGet, "/api/internal/audit/export?link="+id, "", "", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+
+		var lines int
+		scanner := bufio.NewScanner(w.Body)
+		for scanner.Scan() {
+			var e audit.Entry
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+			assert.Equal(t, id, e.LinkID)
+			lines++
+		}
+		assert.Equal(t, 3, lines)
+	})
+
+	t.Run("restart", func(t *testing.T) {
+		reopened, err := audit.Open(auditPath)
+		require.NoError(t, err)
+		assert.Equal(t, al.Query(audit.Filter{}), reopened.Query(audit.Filter{}))
+	})
+}
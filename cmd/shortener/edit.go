@@ -0,0 +1,377 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/ivanlp-p/ShortLinkService/cmd/config"
+	"github.com/ivanlp-p/ShortLinkService/internal/audit"
+	"github.com/ivanlp-p/ShortLinkService/internal/auth"
+	"github.com/ivanlp-p/ShortLinkService/internal/blocklist"
+	"github.com/ivanlp-p/ShortLinkService/internal/limits"
+	"github.com/ivanlp-p/ShortLinkService/internal/models"
+	"github.com/ivanlp-p/ShortLinkService/internal/protect"
+	"github.com/ivanlp-p/ShortLinkService/internal/storage"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// actor возвращает, кто выполняет изменение: идентификатор пользователя, а
+// для служебных эндпоинтов, доступных только из доверенной подсети, —
+// «admin:<IP>».
+func actor(r *http.Request) string {
+	if userID, ok := auth.UserID(r.Context()); ok {
+		return userID
+	}
+	if ip := clientIP(r); ip != nil {
+		return "admin:" + ip.String()
+	}
+	return "admin"
+}
+
+// linkOptions возвращает настройки ссылки в том виде, в каком их принимает API.
+func linkOptions(link models.ShortLink) models.OriginalURL {
+	return models.OriginalURL{
+		URL:            link.OriginalURL,
+		Interstitial:   link.Interstitial,
+		RedirectStatus: link.RedirectStatus,
+		ForwardQuery:   link.ForwardQuery,
+		ForwardPath:    link.ForwardPath,
+		Targeting:      link.Targeting,
+		Variants:       link.Variants,
+		StickyVariant:  link.StickyVariant,
+		MaxClicks:      link.MaxClicks,
+		ActiveFrom:     link.ActiveFrom,
+		ActiveUntil:    link.ActiveUntil,
+		Title:          link.Title,
+		Notes:          link.Notes,
+		Tags:           link.Tags,
+	}
+}
+
+// applyOptions переносит в link настройки из opts. Пароль хешируется
+// отдельно и здесь не трогается.
+func applyOptions(link *models.ShortLink, opts models.OriginalURL) {
+	link.OriginalURL = opts.URL
+	link.Interstitial = opts.Interstitial
+	link.RedirectStatus = opts.RedirectStatus
+	link.ForwardQuery = opts.ForwardQuery
+	link.ForwardPath = opts.ForwardPath
+	link.Targeting = opts.Targeting
+	if emptyTargeting(opts.Targeting) {
+		link.Targeting = nil
+	}
+	link.Variants = opts.Variants
+	link.StickyVariant = opts.StickyVariant
+	link.MaxClicks = opts.MaxClicks
+	link.ActiveFrom = opts.ActiveFrom
+	link.ActiveUntil = opts.ActiveUntil
+	link.Title = strings.TrimSpace(opts.Title)
+	link.Notes = opts.Notes
+	link.Tags = normalizeTags(opts.Tags)
+}
+
+// linkETag — сильный ETag версии ссылки.
+func linkETag(link models.ShortLink) string {
+	return fmt.Sprintf(`"v%d"`, link.Version)
+}
+
+// ifMatchVersion возвращает версию ссылки из заголовка If-Match. Без
+// заголовка изменение отклоняется с 428, чтобы клиент не перезаписал чужую
+// правку вслепую; «*» означает текущую версию.
+func ifMatchVersion(w http.ResponseWriter, r *http.Request, link models.ShortLink) (int, bool) {
+	ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+	if ifMatch == "" {
+		http.Error(w, "Precondition Required: send If-Match with the link ETag", http.StatusPreconditionRequired)
+		return 0, false
+	}
+	if ifMatch == "*" {
+		return link.Version, true
+	}
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == linkETag(link) {
+			return link.Version, true
+		}
+	}
+	writeConflict(w, link)
+	return 0, false
+}
+
+func writeConflict(w http.ResponseWriter, link models.ShortLink) {
+	w.Header().Set("ETag", linkETag(link))
+	http.Error(w, "Precondition Failed: link was modified, current version is "+strconv.Itoa(link.Version), http.StatusPreconditionFailed)
+}
+
+// ownLink возвращает ссылку из запроса, если она принадлежит текущему
+// пользователю. Иначе отвечает 404 или 403 и возвращает false.
+func ownLink(w http.ResponseWriter, r *http.Request, fileStorage *storage.FileStorage) (models.ShortLink, bool) {
+	link, err := fileStorage.GetShortLink(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return models.ShortLink{}, false
+	}
+	userID, ok := auth.UserID(r.Context())
+	if !ok || link.UserID != userID {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return models.ShortLink{}, false
+	}
+	return link, true
+}
+
+// linkInfo возвращает ссылку в том виде, в каком её видит владелец: без хеша пароля.
+func linkInfo(cfg *config.Config, link models.ShortLink) models.LinkInfo {
+	return models.LinkInfo{
+		ShortURL:    cfg.BaseURL + link.ShortURL,
+		OriginalURL: linkOptions(link),
+		Protected:   link.PasswordHash != "",
+		Version:     link.Version,
+		CreatedAt:   link.CreatedAt,
+		UpdatedBy:   link.UpdatedBy,
+		UpdatedAt:   link.UpdatedAt,
+	}
+}
+
+func writeLink(w http.ResponseWriter, cfg *config.Config, link models.ShortLink) {
+	response, err := json.MarshalIndent(linkInfo(cfg, link), "", "   ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", linkETag(link))
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+// handlerLink возвращает владельцу ссылку со всеми настройками и ETag для правки.
+func handlerLink(cfg *config.Config, fileStorage *storage.FileStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		link, ok := ownLink(w, r, fileStorage)
+		if !ok {
+			return
+		}
+		writeLink(w, cfg, link)
+	}
+}
+
+// handlerPatch изменяет адрес назначения и настройки ссылки. Тело — JSON
+// merge patch (RFC 7396) над настройками из models.OriginalURL: заданные
+// поля заменяются, null сбрасывает поле, остальные не меняются.
+// "password": "" снимает пароль.
+func handlerPatch(cfg *config.Config, fileStorage *storage.FileStorage, bl *blocklist.Blocklist, al *audit.Log) http.HandlerFunc {
+	checker := newURLChecker(cfg, bl, fileStorage)
+	return func(w http.ResponseWriter, r *http.Request) {
+		link, ok := ownLink(w, r, fileStorage)
+		if !ok {
+			return
+		}
+		version, ok := ifMatchVersion(w, r, link)
+		if !ok {
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if limit, ok := limits.IsTooLarge(err); ok {
+			limits.TooLarge(w, "request body", limit)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(body, &fields); err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		// Патч накладывается на копию через JSON: указатели и срезы в ссылке
+		// общие с хранилищем, и декодер писал бы прямо в них
+		base, err := json.Marshal(linkOptions(link))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		var opts models.OriginalURL
+		if err := json.Unmarshal(base, &opts); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := json.Unmarshal(body, &opts); err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := validateLinkOptions(opts); err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if opts.URL, ok = checker.check(r.Context(), w, opts.URL); !ok {
+			return
+		}
+		if !checker.checkTargeting(r.Context(), w, opts.Targeting) || !checker.checkVariants(r.Context(), w, opts.Variants) {
+			return
+		}
+		_, setPassword := fields["password"]
+		var passwordHash string
+		if setPassword && opts.Password != "" {
+			if passwordHash, err = protect.HashPassword(r.Context(), opts.Password); err != nil {
+				hashFailed(w, err)
+				return
+			}
+		}
+
+		updatedBy := actor(r)
+		updated, err := fileStorage.UpdateShortLink(r.Context(), link.ShortURL, version, func(current models.ShortLink) (models.ShortLink, error) {
+			applyOptions(&current, opts)
+			if setPassword {
+				current.PasswordHash = passwordHash
+			}
+			current.UpdatedBy = updatedBy
+			return current, nil
+		})
+		if !writeUpdateError(w, updated, err) {
+			return
+		}
+		recordAudit(r, al, cfg, audit.ActionUpdate, &link, updated)
+		writeLink(w, cfg, updated)
+	}
+}
+
+// writeUpdateError отвечает клиенту, если сохранить новую версию не удалось.
+func writeUpdateError(w http.ResponseWriter, current models.ShortLink, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, storage.ErrNotFound):
+		http.Error(w, "Not Found", http.StatusNotFound)
+	case errors.Is(err, storage.ErrVersionConflict):
+		writeConflict(w, current)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+	return false
+}
+
+// handlerHistory возвращает владельцу все версии ссылки, от первой до текущей.
+func handlerHistory(fileStorage *storage.FileStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		link, ok := ownLink(w, r, fileStorage)
+		if !ok {
+			return
+		}
+		versions, err := fileStorage.GetHistory(r.Context(), link.ShortURL)
+		if err != nil {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		history := make([]models.LinkVersion, 0, len(versions))
+		for _, v := range versions {
+			history = append(history, models.LinkVersion{
+				Version:     v.Version,
+				OriginalURL: v.OriginalURL,
+				UpdatedBy:   v.UpdatedBy,
+				UpdatedAt:   v.UpdatedAt,
+			})
+		}
+
+		response, err := json.MarshalIndent(history, "", "   ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", linkETag(link))
+		w.WriteHeader(http.StatusOK)
+		w.Write(response)
+	}
+}
+
+// handlerRollback восстанавливает адрес и настройки одной из прежних версий
+// ссылки. Восстановленное состояние сохраняется как новая версия, так что
+// откат тоже попадает в историю и его можно отменить.
+func handlerRollback(cfg *config.Config, fileStorage *storage.FileStorage, bl *blocklist.Blocklist, al *audit.Log) http.HandlerFunc {
+	checker := newURLChecker(cfg, bl, fileStorage)
+	return func(w http.ResponseWriter, r *http.Request) {
+		link, ok := ownLink(w, r, fileStorage)
+		if !ok {
+			return
+		}
+		version, ok := ifMatchVersion(w, r, link)
+		if !ok {
+			return
+		}
+
+		var req models.Rollback
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			if limit, ok := limits.IsTooLarge(err); ok {
+				limits.TooLarge(w, "request body", limit)
+				return
+			}
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		versions, err := fileStorage.GetHistory(r.Context(), link.ShortURL)
+		if err != nil {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		var target *models.ShortLink
+		for i := range versions[:len(versions)-1] {
+			if versions[i].Version == req.Version {
+				target = &versions[i]
+			}
+		}
+		if target == nil {
+			http.Error(w, fmt.Sprintf("Bad Request: version %d is not a previous version of the link", req.Version), http.StatusBadRequest)
+			return
+		}
+
+		// Правила блокировки могли измениться с тех пор, как версия была актуальна
+		if _, ok := checker.check(r.Context(), w, target.OriginalURL); !ok {
+			return
+		}
+		for _, u := range linkURLs(*target) {
+			if rule, blocked := bl.Check(u); blocked {
+				http.Error(w, http.StatusText(rule.Status)+": destination is blocked: "+rule.Reason, rule.Status)
+				return
+			}
+		}
+
+		updatedBy := actor(r)
+		restored := *target
+		updated, err := fileStorage.UpdateShortLink(r.Context(), link.ShortURL, version, func(current models.ShortLink) (models.ShortLink, error) {
+			restored.UUID = current.UUID
+			restored.UpdatedBy = updatedBy
+			return restored, nil
+		})
+		if !writeUpdateError(w, updated, err) {
+			return
+		}
+		recordAudit(r, al, cfg, audit.ActionRollback, &link, updated)
+		writeLink(w, cfg, updated)
+	}
+}
+
+// linkURLs возвращает адреса из правил и вариантов ссылки.
+func linkURLs(link models.ShortLink) []string {
+	var urls []string
+	if link.Targeting != nil {
+		for _, rule := range link.Targeting.Device {
+			urls = append(urls, rule.URL)
+		}
+		for _, rule := range link.Targeting.Country {
+			urls = append(urls, rule.URL)
+		}
+		for _, rule := range link.Targeting.Language {
+			urls = append(urls, rule.URL)
+		}
+	}
+	for _, v := range link.Variants {
+		urls = append(urls, v.URL)
+	}
+	return urls
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/ivanlp-p/ShortLinkService/cmd/config"
+	"github.com/ivanlp-p/ShortLinkService/internal/auth"
+	"github.com/ivanlp-p/ShortLinkService/internal/models"
+	"github.com/ivanlp-p/ShortLinkService/internal/storage"
+	"github.com/ivanlp-p/ShortLinkService/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_editLink(t *testing.T) {
+	cfg := config.Default()
+	dbPath := filepath.Join(t.TempDir(), "db.json")
+	fileStorage := storage.NewFileStorage(dbPath, storage.NewMapStorage())
+	bl := noBlocklist(t)
+	authn := auth.New([]byte("key"))
+	alice, bob := authn.Cookie("alice"), authn.Cookie("bob")
+
+	router := chi.NewRouter()
+	router.Post("/api/shorten", authn.Handler(PostShortenRequest(cfg, fileStorage, bl, nil)))
+	router.Get("/api/links/{id}", authn.Handler(handlerLink(cfg, fileStorage)))
+	router.Patch("/api/links/{id}", authn.Handler(handlerPatch(cfg, fileStorage, bl, nil)))
+	router.Get("/api/links/{id}/history", authn.Handler(handlerHistory(fileStorage)))
+	router.Post("/api/links/{id}/rollback", authn.Handler(handlerRollback(cfg, fileStorage, bl, nil)))
+
+	send := func(method, target, body, ifMatch string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		if ifMatch != "" {
+			request.Header.Set("If-Match", ifMatch)
+		}
+		if cookie != nil {
+			request.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w
+	}
+
+	w := send(http.MethodPost, "/api/shorten", `{"url": "https://example.com/v1", "targeting": {"country": [{"countries": ["DE"], "url": "https://example.de/v1"}]}}`, "", alice)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var resp models.ShortURL
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	id := strings.TrimPrefix(resp.Result, cfg.BaseURL)
+	linkPath := "/api/links/" + id
+	_, err := fileStorage.RecordClick(context.Background(), id, models.Click{})
+	require.NoError(t, err)
+
+	t.Run("get", func(t *testing.T) {
+		w := send(http.MethodGet, linkPath, "", "", alice)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `"v1"`, w.Header().Get("ETag"))
+		var info models.LinkInfo
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+		assert.Equal(t, "https://example.com/v1", info.URL)
+		assert.Equal(t, 1, info.Version)
+		assert.Equal(t, "alice", info.UpdatedBy)
+
+		assert.Equal(t, http.StatusForbidden, send(http.MethodGet, linkPath, "", "", bob).Code)
+		assert.Equal(t, http.StatusNotFound, send(http.MethodGet, "/api/links/missing", "", "", alice).Code)
+	})
+
+	tests := []struct {
+		name            string
+		body            string
+		ifMatch         string
+		cookie          *http.Cookie
+		expectedCode    int
+		expectedETag    string
+		expectedURL     string
+		expectedMessage string
+	}{
+		{
+			name:         "not_owner",
+			body:         `{"url": "https://evil.example/"}`,
+			ifMatch:      `"v1"`,
+			cookie:       bob,
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:            "no_if_match",
+			body:            `{"url": "https://example.com/v2"}`,
+			cookie:          alice,
+			expectedCode:    http.StatusPreconditionRequired,
+			expectedMessage: "If-Match",
+		},
+		{
+			name:         "destination",
+			body:         `{"url": "https://example.com/v2", "redirect_status": 301, "targeting": {"country": [{"countries": ["DE"], "url": "https://example.de/v2"}]}}`,
+			ifMatch:      `"v1"`,
+			cookie:       alice,
+			expectedCode: http.StatusOK,
+			expectedETag: `"v2"`,
+			expectedURL:  "https://example.com/v2",
+		},
+		{
+			name:            "lost_update",
+			body:            `{"url": "https://example.com/stale"}`,
+			ifMatch:         `"v1"`,
+			cookie:          alice,
+			expectedCode:    http.StatusPreconditionFailed,
+			expectedETag:    `"v2"`,
+			expectedMessage: "current version is 2",
+		},
+		{
+			name:            "invalid",
+			body:            `{"forward_query": "sometimes"}`,
+			ifMatch:         `"v2"`,
+			cookie:          alice,
+			expectedCode:    http.StatusBadRequest,
+			expectedMessage: `forward query "sometimes"`,
+		},
+		{
+			name:         "options_only",
+			body:         `{"interstitial": true, "targeting": null}`,
+			ifMatch:      `"v2"`,
+			cookie:       alice,
+			expectedCode: http.StatusOK,
+			expectedETag: `"v3"`,
+			expectedURL:  "https://example.com/v2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := send(http.MethodPatch, linkPath, tt.body, tt.ifMatch, tt.cookie)
+			assert.Equal(t, tt.expectedCode, w.Code)
+			if tt.expectedETag != "" {
+				assert.Equal(t, tt.expectedETag, w.Header().Get("ETag"))
+			}
+			if tt.expectedMessage != "" {
+				assert.Contains(t, w.Body.String(), tt.expectedMessage)
+			}
+			if tt.expectedURL != "" {
+				var info models.LinkInfo
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+				assert.Equal(t, tt.expectedURL, info.URL)
+			}
+		})
+	}
+
+	link, err := fileStorage.GetShortLink(context.Background(), id)
+	require.NoError(t, err)
+	assert.Equal(t, 3, link.Version)
+	assert.Equal(t, http.StatusMovedPermanently, link.RedirectStatus)
+	assert.True(t, link.Interstitial)
+	assert.Nil(t, link.Targeting)
+
+	t.Run("history", func(t *testing.T) {
+		w := send(http.MethodGet, linkPath+"/history", "", "", alice)
+		require.Equal(t, http.StatusOK, w.Code)
+		var history []models.LinkVersion
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+		require.Len(t, history, 3)
+		for i, want := range []string{"https://example.com/v1", "https://example.com/v2", "https://example.com/v2"} {
+			assert.Equal(t, i+1, history[i].Version)
+			assert.Equal(t, want, history[i].OriginalURL)
+			assert.Equal(t, "alice", history[i].UpdatedBy)
+			assert.False(t, history[i].UpdatedAt.IsZero())
+		}
+
+		versions, err := fileStorage.GetHistory(context.Background(), id)
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.de/v1", versions[0].Targeting.Country[0].URL, "patch must not modify stored versions")
+		for _, v := range versions[:len(versions)-1] {
+			assert.Zero(t, v.Clicks, "version %d: clicks belong to the current version", v.Version)
+		}
+		assert.Equal(t, int64(1), versions[len(versions)-1].Clicks)
+
+		assert.Equal(t, http.StatusForbidden, send(http.MethodGet, linkPath+"/history", "", "", bob).Code)
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		w := send(http.MethodPost, linkPath+"/rollback", `{"version": 3}`, `"v3"`, alice)
+		assert.Equal(t, http.StatusBadRequest, w.Code, "current version")
+
+		w = send(http.MethodPost, linkPath+"/rollback", `{"version": 1}`, `"v2"`, alice)
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+		w = send(http.MethodPost, linkPath+"/rollback", `{"version": 1}`, `"v3"`, alice)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `"v4"`, w.Header().Get("ETag"))
+
+		link, err := fileStorage.GetShortLink(context.Background(), id)
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.com/v1", link.OriginalURL)
+		assert.Equal(t, "https://example.de/v1", link.Targeting.Country[0].URL)
+		assert.False(t, link.Interstitial)
+		assert.Equal(t, "alice", link.UserID)
+	})
+
+	t.Run("redirect_follows_edit", func(t *testing.T) {
+		w := send(http.MethodPatch, linkPath, `{"url": "https://example.com/v5"}`, "*", alice)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		w = getLink(t, handlerGet(cfg, fileStorage, bl, nil, nil, nil), id)
+		assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+		assert.Equal(t, "https://example.com/v5", w.Header().Get("Location"))
+	})
+
+	t.Run("reshorten_does_not_edit", func(t *testing.T) {
+		shorten := func(t *testing.T, body string, cookie *http.Cookie) string {
+			t.Helper()
+			w := send(http.MethodPost, "/api/shorten", body, "", cookie)
+			require.Equal(t, http.StatusCreated, w.Code)
+			var resp models.ShortURL
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			return strings.TrimPrefix(resp.Result, cfg.BaseURL)
+		}
+		get := handlerGet(cfg, fileStorage, bl, nil, nil, nil)
+
+		bobID := shorten(t, `{"url": "https://example.com/v1", "interstitial": true}`, bob)
+		assert.NotEqual(t, id, bobID, "link edited by its owner must not be handed out for its old URL")
+		bobLink, err := fileStorage.GetShortLink(context.Background(), bobID)
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.com/v1", bobLink.OriginalURL)
+		assert.True(t, bobLink.Interstitial)
+		assert.Equal(t, "bob", bobLink.UserID)
+		w := getLink(t, get, bobID)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "https://example.com/v1")
+		assert.NotContains(t, w.Body.String(), "https://example.com/v5")
+
+		aliceID := shorten(t, `{"url": "https://example.com/v1"}`, alice)
+		assert.NotEqual(t, id, aliceID, "the owner's edited link no longer points to the URL either")
+		assert.NotEqual(t, bobID, aliceID)
+		w = getLink(t, get, aliceID)
+		assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+		assert.Equal(t, "https://example.com/v1", w.Header().Get("Location"))
+		assert.Equal(t, aliceID, shorten(t, `{"url": "https://example.com/v1"}`, alice), "same owner and URL get the same link")
+
+		link, err := fileStorage.GetShortLink(context.Background(), id)
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.com/v5", link.OriginalURL, "re-POST must not undo the owner's edit")
+		assert.False(t, link.Interstitial)
+		assert.Equal(t, 5, link.Version)
+		assert.Equal(t, "alice", link.UserID)
+	})
+
+	t.Run("legacy_link_not_adopted", func(t *testing.T) {
+		store := storage.NewMapStorage()
+		legacyID := utils.ShortenURL("https://example.com/legacy")
+		store.Put(models.ShortLink{ShortURL: legacyID, OriginalURL: "https://example.com/legacy"})
+		fileStorage := storage.NewFileStorage(filepath.Join(t.TempDir(), "db.json"), store)
+
+		w := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url": "https://example.com/legacy"}`))
+		request.AddCookie(bob)
+		authn.Handler(PostShortenRequest(cfg, fileStorage, bl, nil))(w, request)
+		require.Equal(t, http.StatusCreated, w.Code)
+		var resp models.ShortURL
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		bobID := strings.TrimPrefix(resp.Result, cfg.BaseURL)
+		assert.NotEqual(t, legacyID, bobID)
+
+		link, err := fileStorage.GetShortLink(context.Background(), legacyID)
+		require.NoError(t, err)
+		assert.Empty(t, link.UserID, "re-POST must not make the caller the owner")
+		link, err = fileStorage.GetShortLink(context.Background(), bobID)
+		require.NoError(t, err)
+		assert.Equal(t, "bob", link.UserID)
+		assert.Equal(t, "https://example.com/legacy", link.OriginalURL)
+	})
+
+	t.Run("survives_restart", func(t *testing.T) {
+		reloaded := storage.NewFileStorage(dbPath, storage.NewMapStorage())
+		require.NoError(t, reloaded.LoadFromFile(context.Background()))
+
+		versions, err := reloaded.GetHistory(context.Background(), id)
+		require.NoError(t, err)
+		require.Len(t, versions, 5)
+		assert.Equal(t, "https://example.com/v1", versions[3].OriginalURL)
+		assert.Equal(t, "https://example.com/v5", versions[4].OriginalURL)
+		assert.Equal(t, "alice", versions[4].UserID)
+	})
+}
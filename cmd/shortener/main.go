@@ -1,74 +1,293 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/ivanlp-p/ShortLinkService/cmd/config"
+	"github.com/ivanlp-p/ShortLinkService/internal/audit"
+	"github.com/ivanlp-p/ShortLinkService/internal/auth"
+	"github.com/ivanlp-p/ShortLinkService/internal/blocklist"
 	"github.com/ivanlp-p/ShortLinkService/internal/compress"
+	"github.com/ivanlp-p/ShortLinkService/internal/geoip"
+	"github.com/ivanlp-p/ShortLinkService/internal/limits"
 	"github.com/ivanlp-p/ShortLinkService/internal/logger"
+	"github.com/ivanlp-p/ShortLinkService/internal/metrics"
 	"github.com/ivanlp-p/ShortLinkService/internal/models"
+	"github.com/ivanlp-p/ShortLinkService/internal/preview"
+	"github.com/ivanlp-p/ShortLinkService/internal/protect"
+	"github.com/ivanlp-p/ShortLinkService/internal/schedule"
 	"github.com/ivanlp-p/ShortLinkService/internal/storage"
+	"github.com/ivanlp-p/ShortLinkService/internal/tracing"
 	"github.com/ivanlp-p/ShortLinkService/internal/utils"
 	"go.uber.org/zap"
 	"io"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 )
 
-func handler(fileStorage *storage.FileStorage) http.HandlerFunc {
+func handler(cfg *config.Config, fileStorage *storage.FileStorage, bl *blocklist.Blocklist, al *audit.Log) http.HandlerFunc {
+	checker := newURLChecker(cfg, bl, fileStorage)
 	return func(w http.ResponseWriter, r *http.Request) {
 		body, err := io.ReadAll(r.Body)
+		if limit, ok := limits.IsTooLarge(err); ok {
+			limits.TooLarge(w, "request body", limit)
+			return
+		}
 		if err != nil || len(body) == 0 {
 			http.Error(w, "Bad Request", http.StatusBadRequest)
 			return
 		}
-		originalURL := strings.TrimSpace(string(body))
-		shortID := utils.ShortenURL(originalURL)
+		originalURL, ok := checker.check(r.Context(), w, strings.TrimSpace(string(body)))
+		if !ok {
+			return
+		}
+		userID, _ := auth.UserID(r.Context())
 		shortLink := models.ShortLink{UUID: uuid.NewString(),
-			ShortURL:    shortID,
 			OriginalURL: originalURL,
+			CreatedAt:   time.Now().UTC(),
+			UserID:      userID,
+			UpdatedBy:   actor(r),
 		}
 
-		fileStorage.SaveShortLink(shortLink)
+		saved, err := createLink(r, fileStorage, al, cfg, shortLink, "")
+		status, ok := createdStatus(w, err)
+		if !ok {
+			return
+		}
 
-		shortURL := fmt.Sprintf(config.BaseURL+"%s", shortID)
+		shortURL := fmt.Sprintf(cfg.BaseURL+"%s", saved.ShortURL)
 
 		w.Header().Set("Content-Type", "text/plain")
-		w.WriteHeader(http.StatusCreated)
+		w.WriteHeader(status)
 		w.Write([]byte(shortURL))
 	}
 }
 
-func handlerGet(fileStorage *storage.FileStorage) http.HandlerFunc {
+func handlerGet(cfg *config.Config, fileStorage *storage.FileStorage, bl *blocklist.Blocklist, geo *geoip.DB, gate *passwordGate, sched *scheduler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		fmt.Println("ID: ", chi.URLParam(r, "id"))
-
 		id := chi.URLParam(r, "id")
+		// Идентификаторы состоят из символов base64url, поэтому «+» в конце однозначно означает предпросмотр
+		id, showPreview := strings.CutSuffix(id, "+")
+		if r.URL.Query().Get("preview") == "1" {
+			showPreview = true
+		}
+		reqLog := logger.FromContext(r.Context())
+		reqLog.Debug("Resolving short link", zap.String("id", id), zap.Bool("preview", showPreview))
 
-		originalURL, err := fileStorage.GetOriginalURL(id)
+		link, err := fileStorage.GetShortLink(r.Context(), id)
 
 		if err != nil {
 			http.Error(w, "Not Found", http.StatusNotFound)
 			return
 		}
+		if chi.URLParam(r, "*") != "" && !link.ForwardPath {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		switch sched.state(link) {
+		case schedule.Pending:
+			sched.writePending(w, cfg, link)
+			return
+		case schedule.Expired:
+			writeGone(w)
+			return
+		}
+		// POST приходит только из формы ввода пароля
+		if link.PasswordHash != "" && (r.Method == http.MethodPost || !gate.unlocked(r, link)) {
+			gate.serve(w, r, cfg, link)
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if exhausted(link) {
+			writeGone(w)
+			return
+		}
 
 		_, err = io.ReadAll(r.Body)
-		if err != nil || originalURL == "" {
+		if err != nil || link.OriginalURL == "" {
 			http.Error(w, "Bad Request", http.StatusBadRequest)
 			return
 		}
 
-		fmt.Println("originalURL: ", originalURL)
+		var country string
+		if ip := clientIP(r); ip != nil {
+			country, _ = geo.Country(ip.String())
+		}
 
+		originalURL, variant, err := destination(r, link, country)
+		if err != nil {
+			reqLog.Error("Building destination failed", zap.String("id", id), zap.Error(err))
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		// Правила могли появиться уже после создания ссылки
+		if rule, blocked := bl.Check(originalURL); blocked {
+			reqLog.Info("Redirect blocked",
+				zap.String("id", id),
+				zap.String("original_url", originalURL),
+				zap.String("rule", rule.Pattern),
+			)
+			blocklist.WritePage(w, rule)
+			return
+		}
+
+		if showPreview {
+			writePreview(w, cfg, link, originalURL, false)
+			return
+		}
+
+		clicks, err := fileStorage.RecordClick(r.Context(), id, models.Click{Variant: variant, Country: country})
+		switch {
+		case errors.Is(err, storage.ErrClickLimit):
+			// Лимит исчерпали одновременные запросы после проверки выше
+			writeGone(w)
+			return
+		case err != nil && !errors.Is(err, storage.ErrNotFound):
+			reqLog.Error("Recording click failed", zap.String("id", id), zap.Error(err))
+		}
+		link.Clicks = clicks
+		if link.StickyVariant && variant != "" {
+			setVariantCookie(w, link, variant)
+		}
+
+		if link.Interstitial {
+			writePreview(w, cfg, link, originalURL, true)
+			return
+		}
+
+		status := redirectStatus(cfg, link)
+		reqLog.Debug("Redirecting", zap.String("original_url", originalURL), zap.String("variant", variant), zap.String("country", country), zap.Int("status", status))
+
+		metrics.RedirectsTotal.Inc()
+
+		w.Header().Set("Cache-Control", redirectCacheControl(cfg, link, status))
+		for _, h := range varyHeaders(link) {
+			w.Header().Add("Vary", h)
+		}
 		w.Header().Set("Location", originalURL)
-		w.WriteHeader(http.StatusTemporaryRedirect)
+		w.WriteHeader(status)
+	}
+}
+
+// maxIDAttempts — сколько идентификаторов перебирает createLink, прежде чем
+// сдаться.
+const maxIDAttempts = 10
+
+// errNoFreeID возвращается, если все идентификаторы для адреса заняты чужими ссылками.
+var errNoFreeID = errors.New("no free short link ID")
+
+// linkID возвращает n-й вариант идентификатора ссылки владельца userID на
+// адрес url: первый — хеш адреса, остальные — хеш с солью из владельца и
+// номера попытки.
+func linkID(url, userID string, n int) string {
+	if n == 0 {
+		return utils.ShortenURL(url)
+	}
+	return utils.ShortenURL(url + "\x00" + userID + "\x00" + strconv.Itoa(n))
+}
+
+// createLink сохраняет новую ссылку и записывает создание в журнал аудита.
+// Если ссылка того же владельца на тот же адрес уже есть, возвращается она:
+// когда в запросе нет настроек или они те же — как созданная, иначе вместе со
+// storage.ErrLinkExists. Чужую ссылку или ссылку, адрес которой с тех пор
+// изменили через PATCH, createLink не возвращает никогда — иначе повторное
+// сокращение адреса вело бы туда, куда её направил владелец, — а занимает
+// следующий идентификатор. password — пароль из запроса до хеширования.
+func createLink(r *http.Request, fileStorage *storage.FileStorage, al *audit.Log, cfg *config.Config, link models.ShortLink, password string) (models.ShortLink, error) {
+	for n := range maxIDAttempts {
+		link.ShortURL = linkID(link.OriginalURL, link.UserID, n)
+		saved, err := fileStorage.SaveShortLink(r.Context(), link)
+		if err == nil {
+			recordAudit(r, al, cfg, audit.ActionCreate, nil, saved)
+			return saved, nil
+		}
+		if !errors.Is(err, storage.ErrLinkExists) {
+			logger.FromContext(r.Context()).Error("Saving short link failed", zap.String("id", link.ShortURL), zap.Error(err))
+			return models.ShortLink{}, err
+		}
+		if saved.UserID != link.UserID || saved.OriginalURL != link.OriginalURL {
+			continue
+		}
+		same, err := sameSettings(r.Context(), saved, link, password)
+		if err != nil {
+			return models.ShortLink{}, err
+		}
+		if same {
+			return saved, nil
+		}
+		return saved, storage.ErrLinkExists
+	}
+	logger.FromContext(r.Context()).Error("Saving short link failed", zap.String("url", link.OriginalURL), zap.Error(errNoFreeID))
+	return models.ShortLink{}, errNoFreeID
+}
+
+// sameSettings сообщает, что запрос на ссылку link с паролем password ничего
+// не меняет в существующей ссылке existing: настроек в нём нет или они те же.
+func sameSettings(ctx context.Context, existing, link models.ShortLink, password string) (bool, error) {
+	if password == "" && sameOptions(link, models.ShortLink{OriginalURL: link.OriginalURL}) {
+		return true, nil
+	}
+	if !sameOptions(existing, link) {
+		return false, nil
+	}
+	if password == "" || existing.PasswordHash == "" {
+		return password == "" && existing.PasswordHash == "", nil
 	}
+	return protect.CheckPassword(ctx, existing.PasswordHash, password)
 }
 
-func PostShortenRequest(fileStorage *storage.FileStorage) http.HandlerFunc {
+// sameOptions сообщает, что у ссылок одинаковые адрес и настройки, кроме пароля.
+func sameOptions(a, b models.ShortLink) bool {
+	ja, errA := json.Marshal(linkOptions(a))
+	jb, errB := json.Marshal(linkOptions(b))
+	return errA == nil && errB == nil && bytes.Equal(ja, jb)
+}
+
+// createdStatus возвращает код ответа на создание ссылки: 201 для новой или
+// такой же существующей ссылки, 409 — если своя ссылка на этот адрес уже
+// есть с другими настройками; тогда в ответе её адрес.
+func createdStatus(w http.ResponseWriter, err error) (int, bool) {
+	switch {
+	case err == nil:
+		return http.StatusCreated, true
+	case errors.Is(err, storage.ErrLinkExists):
+		return http.StatusConflict, true
+	case errors.Is(err, protect.ErrBusy):
+		hashFailed(w, err)
+		return 0, false
+	default:
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return 0, false
+	}
+}
+
+func writePreview(w http.ResponseWriter, cfg *config.Config, link models.ShortLink, destination string, interstitial bool) {
+	preview.WritePage(w, preview.Page{
+		ShortURL:     cfg.BaseURL + link.ShortURL,
+		Destination:  destination,
+		CreatedAt:    link.CreatedAt,
+		Clicks:       link.Clicks,
+		Interstitial: interstitial,
+	})
+}
+
+func PostShortenRequest(cfg *config.Config, fileStorage *storage.FileStorage, bl *blocklist.Blocklist, al *audit.Log) http.HandlerFunc {
+	checker := newURLChecker(cfg, bl, fileStorage)
 	return func(w http.ResponseWriter, r *http.Request) {
 		var originURL models.OriginalURL
 
@@ -78,19 +297,50 @@ func PostShortenRequest(fileStorage *storage.FileStorage) http.HandlerFunc {
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&originURL); err != nil {
+			if limit, ok := limits.IsTooLarge(err); ok {
+				limits.TooLarge(w, "request body", limit)
+				return
+			}
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		url := originURL.URL
-		shortID := utils.ShortenURL(url)
+		if err := validateLinkOptions(originURL); err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		url, ok := checker.check(r.Context(), w, originURL.URL)
+		if !ok || !checker.checkTargeting(r.Context(), w, originURL.Targeting) ||
+			!checker.checkVariants(r.Context(), w, originURL.Variants) {
+			return
+		}
+		var passwordHash string
+		if originURL.Password != "" {
+			hash, err := protect.HashPassword(r.Context(), originURL.Password)
+			if err != nil {
+				hashFailed(w, err)
+				return
+			}
+			passwordHash = hash
+		}
+
+		userID, _ := auth.UserID(r.Context())
 		shortLink := models.ShortLink{UUID: uuid.NewString(),
-			ShortURL:    shortID,
-			OriginalURL: url,
+			CreatedAt:    time.Now().UTC(),
+			PasswordHash: passwordHash,
+			UserID:       userID,
+			UpdatedBy:    actor(r),
 		}
+		originURL.URL = url
+		applyOptions(&shortLink, originURL)
 
-		fileStorage.SaveShortLink(shortLink)
-		shortURL := config.BaseURL + shortID
+		saved, err := createLink(r, fileStorage, al, cfg, shortLink, originURL.Password)
+		status, ok := createdStatus(w, err)
+		if !ok {
+			return
+		}
+		shortURL := cfg.BaseURL + saved.ShortURL
 
 		resp := models.ShortURL{
 			Result: shortURL,
@@ -103,42 +353,158 @@ func PostShortenRequest(fileStorage *storage.FileStorage) http.HandlerFunc {
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusCreated)
+		w.WriteHeader(status)
 		w.Write(response)
 	}
 }
 
 func main() {
-	config.Init()
+	cfg, err := config.Load(os.Args[1:], os.Getenv)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	rl := newReloader(cfg, os.Args[1:], os.Getenv)
+	go rl.watchSignals()
+
+	if err := run(cfg); err != nil {
+		log.Fatal(err)
+	}
+	defer flushTraces()
+
+	compressor, err := compress.New(compress.Options{
+		Level:          cfg.CompressionLevel,
+		MinSize:        cfg.CompressionMinSize,
+		MaxDecodedSize: cfg.MaxDecompressedSize,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	wrap := chain(cfg, rl, compressor)
+
+	bl, err := blocklist.New(cfg.BlocklistPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rl.onReload(func(next *config.Config) error {
+		return bl.Reload(next.BlocklistPath)
+	})
+	go bl.Watch(context.Background(), 5*time.Second, logger.Log)
+
+	geo, err := geoip.New(cfg.GeoIPPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rl.onReload(func(next *config.Config) error {
+		return geo.Reload(next.GeoIPPath)
+	})
+
+	key, err := cookieKey(cfg.CookieSecret)
+	if err != nil {
+		log.Fatal(err)
+	}
+	gate := newPasswordGate(key, cfg.LinkPasswordMaxFailures)
+	authn := auth.New(key)
+	authn.Secure = strings.HasPrefix(cfg.BaseURL, "https://")
+
+	inactivePage, err := schedule.NewPage(cfg.InactivePagePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rl.onReload(func(next *config.Config) error {
+		return inactivePage.Reload(next.InactivePagePath)
+	})
+	sched := newScheduler(inactivePage)
 
-	if err := run(); err != nil {
+	al, err := audit.Open(cfg.AuditLogPath)
+	if err != nil {
 		log.Fatal(err)
 	}
 
 	store := storage.NewMapStorage()
-	fileStorage := storage.NewFileStorage(config.FileStorage, store)
+	fileStorage := storage.NewFileStorage(cfg.FileStorage, store)
 
-	err := fileStorage.LoadFromFile()
+	err = fileStorage.LoadFromFile(context.Background())
 	if err != nil {
 		logger.Log.Error("Store not load")
 	}
 
 	r := chi.NewRouter()
 	r.Route("/", func(r chi.Router) {
-		r.Post("/", logger.RequestLogger(compress.GzipCompress(handler(fileStorage))))
-		r.Get("/{id}", logger.RequestLogger(compress.GzipCompress(handlerGet(fileStorage))))
+		r.Get("/metrics", wrap(metrics.Handler().ServeHTTP))
+		r.Post("/", wrap(authn.Handler(handler(cfg, fileStorage, bl, al))))
+		r.Get("/{id}", wrap(handlerGet(cfg, fileStorage, bl, geo, gate, sched)))
+		r.Get("/{id}/*", wrap(handlerGet(cfg, fileStorage, bl, geo, gate, sched)))
+		r.Post("/{id}", wrap(handlerGet(cfg, fileStorage, bl, geo, gate, sched)))
+		r.Post("/{id}/*", wrap(handlerGet(cfg, fileStorage, bl, geo, gate, sched)))
 		r.Route("/api/", func(r chi.Router) {
-			r.Post("/shorten", logger.RequestLogger(PostShortenRequest(fileStorage)))
+			r.Post("/shorten", wrap(authn.Handler(PostShortenRequest(cfg, fileStorage, bl, al))))
+			r.Get("/user/urls", wrap(authn.Handler(handlerUserURLs(cfg, fileStorage))))
+			r.Get("/links/{id}", wrap(authn.Handler(handlerLink(cfg, fileStorage))))
+			r.Patch("/links/{id}", wrap(authn.Handler(handlerPatch(cfg, fileStorage, bl, al))))
+			r.Get("/links/{id}/history", wrap(authn.Handler(handlerHistory(fileStorage))))
+			r.Post("/links/{id}/rollback", wrap(authn.Handler(handlerRollback(cfg, fileStorage, bl, al))))
+			r.Get("/links/{id}/qr", wrap(handlerQR(cfg, fileStorage)))
+			r.Get("/links/{id}/stats", wrap(trustedOnly(rl, handlerStats(fileStorage))))
+			r.Put("/links/{id}/targeting", wrap(trustedOnly(rl, handlerTargeting(cfg, fileStorage, bl, al))))
+			r.Post("/internal/config/reload", wrap(trustedOnly(rl, handlerReloadConfig(rl))))
+			r.Get("/internal/audit", wrap(trustedOnly(rl, handlerAudit(al))))
+			r.Get("/internal/audit/export", wrap(trustedOnly(rl, handlerAuditExport(al))))
 		})
 	})
 
-	log.Fatal(http.ListenAndServe(config.Address, r))
+	srv := &http.Server{Addr: cfg.Address, Handler: r}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		<-ctx.Done()
+		logger.Log.Info("Shutting down server")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			logger.Log.Error("Server shutdown failed", zap.Error(err))
+		}
+	}()
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		flushTraces()
+		log.Fatal(err)
+	}
+	// ListenAndServe возвращается сразу, а Shutdown ещё дожидается запросов
+	<-drained
 }
 
-func run() error {
-	if err := logger.Initialize(config.LogLevel); err != nil {
+// shutdownTimeout — сколько ждать завершения запросов и отправки спанов при остановке.
+const shutdownTimeout = 10 * time.Second
+
+// flushTraces останавливает трассировщик и досылает накопленные спаны:
+// они отправляются пачками, и без этого последние спаны терялись бы при выходе.
+func flushTraces() {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := tracing.Default.Shutdown(ctx); err != nil {
+		logger.Log.Error("Flushing traces failed", zap.Error(err))
+	}
+}
+
+// chain возвращает общую для всех маршрутов цепочку middleware.
+func chain(cfg *config.Config, rl *reloader, compressor *compress.Compressor) func(http.HandlerFunc) http.HandlerFunc {
+	return func(h http.HandlerFunc) http.HandlerFunc {
+		return logger.RequestLogger(tracing.Middleware(rl.realIP(limits.Body(cfg.MaxBodySize, compressor.Handler(h)))))
+	}
+}
+
+func run(cfg *config.Config) error {
+	if err := logger.Initialize(cfg.LogLevel); err != nil {
 		return err
 	}
-	logger.Log.Info("Running server on", zap.String("Address", config.Address))
+	switch cfg.TraceExporter {
+	case config.TraceExporterStdout:
+		tracing.Default = tracing.NewTracer(tracing.NewStdoutExporter(os.Stdout))
+	case config.TraceExporterOTLP:
+		tracing.Default = tracing.NewTracer(tracing.NewOTLPExporter(cfg.OTLPEndpoint, "shortener"))
+	}
+	logger.Log.Info("Running server on", zap.String("Address", cfg.Address))
 	return nil
 }
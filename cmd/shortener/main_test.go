@@ -2,20 +2,36 @@ package main
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/json"
 	"github.com/go-chi/chi/v5"
 	"github.com/ivanlp-p/ShortLinkService/cmd/config"
+	"github.com/ivanlp-p/ShortLinkService/internal/blocklist"
+	"github.com/ivanlp-p/ShortLinkService/internal/compress"
+	"github.com/ivanlp-p/ShortLinkService/internal/models"
 	"github.com/ivanlp-p/ShortLinkService/internal/storage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 )
 
+func noBlocklist(t *testing.T) *blocklist.Blocklist {
+	t.Helper()
+	bl, err := blocklist.New("")
+	require.NoError(t, err)
+	return bl
+}
+
 func Test_handler(t *testing.T) {
-	config.BaseURL = "http://localhost:8080/"
+	cfg := config.Default()
 	store := storage.NewMapStorage()
 	fileStorage := storage.NewFileStorage("/tmp/short-url-db.json", store)
 
@@ -40,6 +56,36 @@ func Test_handler(t *testing.T) {
 				body:        "http://localhost:8080/-8eOIgoJ",
 			},
 		},
+		{
+			name:    "equivalent_url_same_code",
+			request: "/",
+			body:    "HTTPS://RCIMBVS.com:443/iuymedy",
+			want: want{
+				contentType: "text/plain",
+				statusCode:  201,
+				body:        "http://localhost:8080/-8eOIgoJ",
+			},
+		},
+		{
+			name:    "not_a_url",
+			request: "/",
+			body:    "not a url",
+			want: want{
+				contentType: "text/plain; charset=utf-8",
+				statusCode:  400,
+				body:        "Bad Request: invalid URL: contains whitespace\n",
+			},
+		},
+		{
+			name:    "javascript_scheme",
+			request: "/",
+			body:    "javascript:alert(1)",
+			want: want{
+				contentType: "text/plain; charset=utf-8",
+				statusCode:  400,
+				body:        "Bad Request: invalid URL: scheme \"javascript\" is not allowed\n",
+			},
+		},
 		{
 			name:    "body_is_empty",
 			request: "/",
@@ -55,7 +101,7 @@ func Test_handler(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			request := httptest.NewRequest(http.MethodPost, tt.request, bytes.NewBufferString(tt.body))
 			w := httptest.NewRecorder()
-			h := handler(fileStorage)
+			h := handler(cfg, fileStorage, noBlocklist(t), nil)
 			h(w, request)
 
 			result := w.Result()
@@ -142,7 +188,7 @@ func Test_handlerGet(t *testing.T) {
 			request = request.WithContext(context.WithValue(request.Context(), chi.RouteCtxKey, rctx))
 
 			w := httptest.NewRecorder()
-			h := handlerGet(fileStorage)
+			h := handlerGet(config.Default(), fileStorage, noBlocklist(t), nil, nil, nil)
 			h(w, request)
 
 			result := w.Result()
@@ -158,7 +204,7 @@ func Test_handlerGet(t *testing.T) {
 }
 
 func Test_PostShortenRequest(t *testing.T) {
-	config.BaseURL = "http://localhost:8080/"
+	cfg := config.Default()
 	store := storage.NewMapStorage()
 	fileStorage := storage.NewFileStorage("/tmp/short-url-db.json", store)
 	request := "/api/shorten/"
@@ -211,7 +257,7 @@ func Test_PostShortenRequest(t *testing.T) {
 		t.Run(tc.method, func(t *testing.T) {
 			request := httptest.NewRequest(tc.method, request, bytes.NewBufferString(tc.body))
 			w := httptest.NewRecorder()
-			h := PostShortenRequest(fileStorage)
+			h := PostShortenRequest(cfg, fileStorage, noBlocklist(t), nil)
 			h(w, request)
 
 			result := w.Result()
@@ -240,3 +286,456 @@ func Test_PostShortenRequest(t *testing.T) {
 	}
 
 }
+
+func Test_limits(t *testing.T) {
+	cfg := config.Default()
+	cfg.MaxBodySize = 100
+	cfg.MaxDecompressedSize = 200
+	cfg.MaxURLLength = 40
+	store := storage.NewMapStorage()
+	fileStorage := storage.NewFileStorage(filepath.Join(t.TempDir(), "db.json"), store)
+
+	opts := compress.DefaultOptions()
+	opts.MaxDecodedSize = cfg.MaxDecompressedSize
+	compressor, err := compress.New(opts)
+	require.NoError(t, err)
+	wrap := chain(cfg, newReloader(cfg, nil, nil), compressor)
+
+	gzipped := func(s string) *bytes.Buffer {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte(s))
+		zw.Close()
+		return &buf
+	}
+
+	tests := []struct {
+		name         string
+		handler      http.HandlerFunc
+		body         io.Reader
+		gzip         bool
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "plain_ok",
+			handler:      handler(cfg, fileStorage, noBlocklist(t), nil),
+			body:         strings.NewReader("https://practicum.yandex.ru"),
+			expectedCode: http.StatusCreated,
+		},
+		{
+			name:         "plain_body_too_large",
+			handler:      handler(cfg, fileStorage, noBlocklist(t), nil),
+			body:         strings.NewReader("https://practicum.yandex.ru/" + strings.Repeat("a", 100)),
+			expectedCode: http.StatusRequestEntityTooLarge,
+			expectedBody: "request body exceeds 100 bytes",
+		},
+		{
+			name:         "plain_url_too_long",
+			handler:      handler(cfg, fileStorage, noBlocklist(t), nil),
+			body:         strings.NewReader("https://practicum.yandex.ru/" + strings.Repeat("a", 20)),
+			expectedCode: http.StatusRequestEntityTooLarge,
+			expectedBody: "URL exceeds 40 bytes",
+		},
+		{
+			name:         "json_url_too_long",
+			handler:      PostShortenRequest(cfg, fileStorage, noBlocklist(t), nil),
+			body:         strings.NewReader(`{"url": "https://practicum.yandex.ru/aaaaaaaaaaaaaaaaaaaa"}`),
+			expectedCode: http.StatusRequestEntityTooLarge,
+			expectedBody: "URL exceeds 40 bytes",
+		},
+		{
+			name:         "json_body_too_large",
+			handler:      PostShortenRequest(cfg, fileStorage, noBlocklist(t), nil),
+			body:         strings.NewReader(`{"url": "https://practicum.yandex.ru", "pad": "` + strings.Repeat("a", 100) + `"}`),
+			expectedCode: http.StatusRequestEntityTooLarge,
+			expectedBody: "request body exceeds 100 bytes",
+		},
+		{
+			name:         "gzip_decompression_bomb",
+			handler:      PostShortenRequest(cfg, fileStorage, noBlocklist(t), nil),
+			body:         gzipped(`{"url": "https://practicum.yandex.ru", "pad": "` + strings.Repeat("a", 1000) + `"}`),
+			gzip:         true,
+			expectedCode: http.StatusRequestEntityTooLarge,
+			expectedBody: "request body exceeds 200 bytes",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/", tt.body)
+			if tt.gzip {
+				request.Header.Set("Content-Encoding", "gzip")
+			}
+			w := httptest.NewRecorder()
+			wrap(tt.handler)(w, request)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.Contains(t, w.Body.String(), tt.expectedBody)
+		})
+	}
+}
+
+func Test_blocklist(t *testing.T) {
+	cfg := config.Default()
+	dir := t.TempDir()
+	store := storage.NewMapStorage()
+	fileStorage := storage.NewFileStorage(filepath.Join(dir, "db.json"), store)
+
+	rulesPath := filepath.Join(dir, "blocklist.txt")
+	require.NoError(t, os.WriteFile(rulesPath, []byte("evil.example\n"), 0644))
+	bl, err := blocklist.New(rulesPath)
+	require.NoError(t, err)
+
+	create := handler(cfg, fileStorage, bl, nil)
+
+	w := httptest.NewRecorder()
+	create(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://evil.example/login")))
+	assert.Equal(t, http.StatusForbidden, w.Code, "blocked destination must not be shortened")
+	assert.Contains(t, w.Body.String(), "destination is blocked")
+
+	w = httptest.NewRecorder()
+	create(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://later.example/login")))
+	require.Equal(t, http.StatusCreated, w.Code)
+	id := strings.TrimPrefix(w.Body.String(), cfg.BaseURL)
+
+	require.NoError(t, os.WriteFile(rulesPath, []byte("*.example 451 Blocked by court order\n"), 0644))
+	require.NoError(t, bl.Reload(rulesPath))
+
+	request := httptest.NewRequest(http.MethodGet, "/"+id, nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", id)
+	request = request.WithContext(context.WithValue(request.Context(), chi.RouteCtxKey, rctx))
+
+	w = httptest.NewRecorder()
+	handlerGet(config.Default(), fileStorage, bl, nil, nil, nil)(w, request)
+
+	assert.Equal(t, http.StatusUnavailableForLegalReasons, w.Code, "existing link must stop redirecting")
+	assert.Empty(t, w.Header().Get("Location"))
+	assert.Contains(t, w.Body.String(), "Blocked by court order")
+}
+
+func Test_selfReference(t *testing.T) {
+	cfg := config.Default()
+	store := storage.NewMapStorage()
+	fileStorage := storage.NewFileStorage(filepath.Join(t.TempDir(), "db.json"), store)
+
+	create := handler(cfg, fileStorage, noBlocklist(t), nil)
+
+	w := httptest.NewRecorder()
+	create(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://example.com/final")))
+	require.Equal(t, http.StatusCreated, w.Code)
+	shortURL := w.Body.String()
+
+	w = httptest.NewRecorder()
+	create(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(shortURL)))
+	assert.Equal(t, http.StatusBadRequest, w.Code, "short link to our own link must be rejected")
+	assert.Contains(t, w.Body.String(), "points to this shortener")
+
+	cfg.FlattenChains = true
+	create = handler(cfg, fileStorage, noBlocklist(t), nil)
+
+	w = httptest.NewRecorder()
+	create(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(shortURL)))
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, shortURL, w.Body.String(), "flattened chain must resolve to the existing link")
+}
+
+func Test_preview(t *testing.T) {
+	cfg := config.Default()
+	store := storage.NewMapStorage()
+	fileStorage := storage.NewFileStorage(filepath.Join(t.TempDir(), "db.json"), store)
+
+	create := PostShortenRequest(cfg, fileStorage, noBlocklist(t), nil)
+	shorten := func(body string) string {
+		w := httptest.NewRecorder()
+		create(w, httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(body)))
+		require.Equal(t, http.StatusCreated, w.Code)
+		var resp models.ShortURL
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return strings.TrimPrefix(resp.Result, cfg.BaseURL)
+	}
+	plain := shorten(`{"url": "https://example.com/plain"}`)
+	guarded := shorten(`{"url": "https://example.com/guarded", "interstitial": true}`)
+	split := shorten(`{"url": "https://example.com/base", "variants": [{"name": "a", "url": "https://example.com/variant-a", "weight": 1}]}`)
+
+	get := func(id, target string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, target, nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		request = request.WithContext(context.WithValue(request.Context(), chi.RouteCtxKey, rctx))
+		w := httptest.NewRecorder()
+		handlerGet(cfg, fileStorage, noBlocklist(t), nil, nil, nil)(w, request)
+		return w
+	}
+
+	w := get(plain, "/"+plain)
+	require.Equal(t, http.StatusTemporaryRedirect, w.Code)
+
+	for _, w := range []*httptest.ResponseRecorder{get(plain+"+", "/"+plain+"+"), get(plain, "/"+plain+"?preview=1")} {
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("Location"))
+		assert.Contains(t, w.Body.String(), "https://example.com/plain")
+		assert.Contains(t, w.Body.String(), "<dd>1</dd>", "preview must show clicks and not count itself")
+	}
+
+	w = get(split+"+", "/"+split+"+")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "https://example.com/variant-a", "preview must show the actual destination")
+	assert.NotContains(t, w.Body.String(), "https://example.com/base")
+
+	w = get(guarded, "/"+guarded)
+	assert.Equal(t, http.StatusOK, w.Code, "interstitial link must not redirect directly")
+	assert.Empty(t, w.Header().Get("Location"))
+	assert.Contains(t, w.Body.String(), "Check the destination")
+	assert.Contains(t, w.Body.String(), `href="https://example.com/guarded"`)
+
+	w = get("missing+", "/missing+")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func Test_redirectStatus(t *testing.T) {
+	cfg := config.Default()
+	store := storage.NewMapStorage()
+	store.Set("default", "https://example.com/default")
+	store.Put(models.ShortLink{ShortURL: "permanent", OriginalURL: "https://example.com/permanent", RedirectStatus: http.StatusPermanentRedirect})
+	fileStorage := storage.NewFileStorage(filepath.Join(t.TempDir(), "db.json"), store)
+
+	tests := []struct {
+		name          string
+		id            string
+		defaultStatus int
+		expectedCode  int
+		expectedCache string
+	}{
+		{
+			name:          "server_default",
+			id:            "default",
+			defaultStatus: http.StatusTemporaryRedirect,
+			expectedCode:  http.StatusTemporaryRedirect,
+			expectedCache: "no-store",
+		},
+		{
+			name:          "configured_default",
+			id:            "default",
+			defaultStatus: http.StatusMovedPermanently,
+			expectedCode:  http.StatusMovedPermanently,
+			expectedCache: "public, max-age=300",
+		},
+		{
+			name:          "per_link",
+			id:            "permanent",
+			defaultStatus: http.StatusFound,
+			expectedCode:  http.StatusPermanentRedirect,
+			expectedCache: "public, max-age=300",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.RedirectStatus = tt.defaultStatus
+
+			request := httptest.NewRequest(http.MethodGet, "/"+tt.id, nil)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", tt.id)
+			request = request.WithContext(context.WithValue(request.Context(), chi.RouteCtxKey, rctx))
+
+			w := httptest.NewRecorder()
+			handlerGet(cfg, fileStorage, noBlocklist(t), nil, nil, nil)(w, request)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.Equal(t, tt.expectedCache, w.Header().Get("Cache-Control"))
+			assert.NotEmpty(t, w.Header().Get("Location"))
+		})
+	}
+
+	t.Run("create", func(t *testing.T) {
+		create := PostShortenRequest(cfg, fileStorage, noBlocklist(t), nil)
+
+		w := httptest.NewRecorder()
+		create(w, httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url": "https://example.com/new", "redirect_status": 301}`)))
+		require.Equal(t, http.StatusCreated, w.Code)
+		var resp models.ShortURL
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		link, err := fileStorage.GetShortLink(context.Background(), strings.TrimPrefix(resp.Result, cfg.BaseURL))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusMovedPermanently, link.RedirectStatus)
+
+		w = httptest.NewRecorder()
+		create(w, httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url": "https://example.com/new", "redirect_status": 303}`)))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "redirect status 303")
+	})
+}
+
+func Test_forwarding(t *testing.T) {
+	cfg := config.Default()
+	store := storage.NewMapStorage()
+	store.Set("plain", "https://example.com/landing?ref=short")
+	store.Put(models.ShortLink{
+		ShortURL:     "fwd",
+		OriginalURL:  "https://example.com/docs?ref=short",
+		ForwardQuery: "incoming",
+		ForwardPath:  true,
+	})
+	fileStorage := storage.NewFileStorage(filepath.Join(t.TempDir(), "db.json"), store)
+
+	h := handlerGet(cfg, fileStorage, noBlocklist(t), nil, nil, nil)
+	router := chi.NewRouter()
+	router.Get("/{id}", h)
+	router.Get("/{id}/*", h)
+
+	tests := []struct {
+		name             string
+		target           string
+		expectedCode     int
+		expectedLocation string
+	}{
+		{
+			name:             "query_dropped_by_default",
+			target:           "/plain?utm_source=mail",
+			expectedCode:     http.StatusTemporaryRedirect,
+			expectedLocation: "https://example.com/landing?ref=short",
+		},
+		{
+			name:         "path_not_forwarded",
+			target:       "/plain/extra",
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:             "query_merged",
+			target:           "/fwd?utm_source=mail&ref=campaign",
+			expectedCode:     http.StatusTemporaryRedirect,
+			expectedLocation: "https://example.com/docs?ref=campaign&utm_source=mail",
+		},
+		{
+			name:             "path_and_query",
+			target:           "/fwd/guide/install?utm_source=mail",
+			expectedCode:     http.StatusTemporaryRedirect,
+			expectedLocation: "https://example.com/docs/guide/install?ref=short&utm_source=mail",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.Equal(t, tt.expectedLocation, w.Header().Get("Location"))
+		})
+	}
+
+	t.Run("invalid_policy", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		body := strings.NewReader(`{"url": "https://example.com/", "forward_query": "merge"}`)
+		PostShortenRequest(cfg, fileStorage, noBlocklist(t), nil)(w, httptest.NewRequest(http.MethodPost, "/api/shorten", body))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "forward query")
+	})
+}
+
+func Test_maxClicks(t *testing.T) {
+	cfg := config.Default()
+	dbPath := filepath.Join(t.TempDir(), "db.json")
+	fileStorage := storage.NewFileStorage(dbPath, storage.NewMapStorage())
+
+	w := httptest.NewRecorder()
+	body := strings.NewReader(`{"url": "https://files.example.com/report.pdf", "max_clicks": 10}`)
+	PostShortenRequest(cfg, fileStorage, noBlocklist(t), nil)(w, httptest.NewRequest(http.MethodPost, "/api/shorten", body))
+	require.Equal(t, http.StatusCreated, w.Code)
+	var resp models.ShortURL
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	id := strings.TrimPrefix(resp.Result, cfg.BaseURL)
+
+	h := handlerGet(cfg, fileStorage, noBlocklist(t), nil, nil, nil)
+
+	t.Run("concurrent", func(t *testing.T) {
+		const requests = 50
+		var (
+			wg    sync.WaitGroup
+			mu    sync.Mutex
+			codes = make(map[int]int)
+		)
+		for range requests {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				w := getLink(t, h, id)
+				mu.Lock()
+				codes[w.Code]++
+				mu.Unlock()
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, map[int]int{http.StatusTemporaryRedirect: 10, http.StatusGone: requests - 10}, codes)
+		stats, err := fileStorage.GetStats(context.Background(), id)
+		require.NoError(t, err)
+		assert.Equal(t, int64(10), stats.Clicks)
+	})
+
+	t.Run("survives_restart", func(t *testing.T) {
+		reloaded := storage.NewFileStorage(dbPath, storage.NewMapStorage())
+		require.NoError(t, reloaded.LoadFromFile(context.Background()))
+
+		w := getLink(t, handlerGet(cfg, reloaded, noBlocklist(t), nil, nil, nil), id)
+		assert.Equal(t, http.StatusGone, w.Code)
+		assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	})
+
+	t.Run("one_time", func(t *testing.T) {
+		store := storage.NewMapStorage()
+		store.Put(models.ShortLink{ShortURL: "once", OriginalURL: "https://files.example.com/key", MaxClicks: 1})
+		h := handlerGet(cfg, storage.NewFileStorage(filepath.Join(t.TempDir(), "db.json"), store), noBlocklist(t), nil, nil, nil)
+
+		w := getLink(t, h, "once")
+		assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+		assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+		assert.Equal(t, http.StatusGone, getLink(t, h, "once").Code)
+		assert.Equal(t, http.StatusGone, getLink(t, h, "once+").Code, "preview of an exhausted link")
+	})
+
+	t.Run("reshorten_keeps_limit", func(t *testing.T) {
+		const target = "https://files.example.com/invite"
+		w := httptest.NewRecorder()
+		body := strings.NewReader(`{"url": "` + target + `", "max_clicks": 2}`)
+		PostShortenRequest(cfg, fileStorage, noBlocklist(t), nil)(w, httptest.NewRequest(http.MethodPost, "/api/shorten", body))
+		require.Equal(t, http.StatusCreated, w.Code)
+		var resp models.ShortURL
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		id := strings.TrimPrefix(resp.Result, cfg.BaseURL)
+		require.Equal(t, http.StatusTemporaryRedirect, getLink(t, h, id).Code)
+
+		w = httptest.NewRecorder()
+		handler(cfg, fileStorage, noBlocklist(t), nil)(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(target)))
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, resp.Result, w.Body.String())
+		w = httptest.NewRecorder()
+		body = strings.NewReader(`{"url": "` + target + `"}`)
+		PostShortenRequest(cfg, fileStorage, noBlocklist(t), nil)(w, httptest.NewRequest(http.MethodPost, "/api/shorten", body))
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.JSONEq(t, `{"result": "`+resp.Result+`"}`, w.Body.String())
+		w = httptest.NewRecorder()
+		body = strings.NewReader(`{"url": "` + target + `", "max_clicks": 5}`)
+		PostShortenRequest(cfg, fileStorage, noBlocklist(t), nil)(w, httptest.NewRequest(http.MethodPost, "/api/shorten", body))
+		assert.Equal(t, http.StatusConflict, w.Code, "other limit for the same link")
+		assert.JSONEq(t, `{"result": "`+resp.Result+`"}`, w.Body.String())
+
+		reloaded := storage.NewFileStorage(dbPath, storage.NewMapStorage())
+		require.NoError(t, reloaded.LoadFromFile(context.Background()))
+		link, err := reloaded.GetShortLink(context.Background(), id)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), link.MaxClicks)
+		assert.Equal(t, int64(1), link.Clicks, "used clicks must survive the re-POST and a restart")
+
+		h := handlerGet(cfg, reloaded, noBlocklist(t), nil, nil, nil)
+		assert.Equal(t, http.StatusTemporaryRedirect, getLink(t, h, id).Code)
+		assert.Equal(t, http.StatusGone, getLink(t, h, id).Code)
+	})
+
+	t.Run("negative", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		body := strings.NewReader(`{"url": "https://files.example.com/", "max_clicks": -1}`)
+		PostShortenRequest(cfg, fileStorage, noBlocklist(t), nil)(w, httptest.NewRequest(http.MethodPost, "/api/shorten", body))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "max clicks -1")
+	})
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"github.com/ivanlp-p/ShortLinkService/cmd/config"
+	"github.com/ivanlp-p/ShortLinkService/internal/logger"
+	"github.com/ivanlp-p/ShortLinkService/internal/models"
+	"github.com/ivanlp-p/ShortLinkService/internal/protect"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	unlockCookiePrefix = "sl_unlock_"
+	unlockCookieMaxAge = time.Hour
+
+	maxPasswordFailures   = 5
+	passwordFailureWindow = 15 * time.Minute
+)
+
+// passwordGate пропускает к ссылкам с паролем только посетителей с
+// действующей cookie доступа и выдаёт такие cookie после ввода пароля.
+type passwordGate struct {
+	signer *protect.Signer
+	// throttle считает ошибки по ссылке и адресу клиента, linkThrottle — по
+	// ссылке целиком (nil — без блокировки ссылки целиком).
+	throttle     *protect.Throttle
+	linkThrottle *protect.Throttle
+	now          func() time.Time
+	// check — проверка пароля; в тестах подменяется.
+	check func(ctx context.Context, hash, password string) (bool, error)
+}
+
+// newPasswordGate создаёт passwordGate с ключом подписи key. После
+// maxLinkFailures ошибок со всех адресов вместе форма ссылки закрывается до
+// конца окна, чтобы перебор с множества адресов не был бесконечным; 0
+// отключает эту блокировку (см. config.Config.LinkPasswordMaxFailures).
+func newPasswordGate(key []byte, maxLinkFailures int) *passwordGate {
+	g := &passwordGate{
+		signer:   protect.NewSigner(key),
+		throttle: protect.NewThrottle(maxPasswordFailures, passwordFailureWindow),
+		now:      time.Now,
+		check:    protect.CheckPassword,
+	}
+	if maxLinkFailures > 0 {
+		g.linkThrottle = protect.NewThrottle(maxLinkFailures, passwordFailureWindow)
+	}
+	return g
+}
+
+// cookieKey возвращает ключ подписи cookie из настроек. Без ключа берётся
+// случайный, и после перезапуска выданные cookie перестают действовать.
+func cookieKey(secret string) ([]byte, error) {
+	if secret != "" {
+		return []byte(secret), nil
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func unlockCookieName(link models.ShortLink) string {
+	return unlockCookiePrefix + link.ShortURL
+}
+
+// unlocked сообщает, что посетитель уже ввёл пароль к link.
+func (g *passwordGate) unlocked(r *http.Request, link models.ShortLink) bool {
+	c, err := r.Cookie(unlockCookieName(link))
+	if err != nil {
+		return false
+	}
+	return g.signer.Verify(link.ShortURL, link.PasswordHash, c.Value, g.now())
+}
+
+// serve показывает форму ввода пароля, а для отправленной формы проверяет
+// пароль. После верного пароля посетитель получает cookie доступа и
+// перенаправляется на тот же адрес, уже методом GET.
+func (g *passwordGate) serve(w http.ResponseWriter, r *http.Request, cfg *config.Config, link models.ShortLink) {
+	form := protect.Form{ShortURL: cfg.BaseURL + link.ShortURL, Action: r.URL.RequestURI()}
+	if r.Method != http.MethodPost {
+		protect.WriteForm(w, http.StatusUnauthorized, form)
+		return
+	}
+
+	// clientIP не доверяет X-Real-IP от клиентов напрямую, так что сменой
+	// заголовка счётчик не сбросить
+	key := link.ShortURL
+	if ip := clientIP(r); ip != nil {
+		key += "|" + ip.String()
+	}
+	// Allow сразу засчитывает попытку как неудачную: пока пароль проверяется,
+	// параллельные запросы уже видят её в счётчике
+	retryAfter, ok := g.throttle.Allow(key)
+	if ok {
+		if retryAfter, ok = g.linkThrottle.Allow(link.ShortURL); !ok {
+			g.throttle.Refund(key)
+		}
+	}
+	if !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Round(time.Second)/time.Second)))
+		form.Error = "Too many attempts. Try again later."
+		protect.WriteForm(w, http.StatusTooManyRequests, form)
+		return
+	}
+
+	match, err := g.check(r.Context(), link.PasswordHash, r.PostFormValue("password"))
+	if err != nil {
+		g.throttle.Refund(key)
+		g.linkThrottle.Refund(link.ShortURL)
+		w.Header().Set("Retry-After", "1")
+		form.Error = "Server is busy. Try again later."
+		protect.WriteForm(w, http.StatusServiceUnavailable, form)
+		return
+	}
+	if !match {
+		logger.FromContext(r.Context()).Info("Wrong link password", zap.String("id", link.ShortURL))
+		form.Error = "Wrong password."
+		protect.WriteForm(w, http.StatusUnauthorized, form)
+		return
+	}
+
+	g.throttle.Reset(key)
+	g.linkThrottle.Refund(link.ShortURL)
+	expires := g.now().Add(unlockCookieMaxAge)
+	http.SetCookie(w, &http.Cookie{
+		Name:  unlockCookieName(link),
+		Value: g.signer.Sign(link.ShortURL, link.PasswordHash, expires),
+		// Путь «/», а не «/<id>», чтобы cookie приходила и на страницу предпросмотра «/<id>+»
+		Path:     "/",
+		Expires:  expires,
+		MaxAge:   int(unlockCookieMaxAge / time.Second),
+		Secure:   strings.HasPrefix(cfg.BaseURL, "https://"),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, r.URL.RequestURI(), http.StatusSeeOther)
+}
+
+// hashFailed отвечает на ошибку protect.HashPassword: если слоты хеширования
+// заняты — 503 с Retry-After, иначе 500.
+func hashFailed(w http.ResponseWriter, err error) {
+	if errors.Is(err, protect.ErrBusy) {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/ivanlp-p/ShortLinkService/cmd/config"
+	"github.com/ivanlp-p/ShortLinkService/internal/models"
+	"github.com/ivanlp-p/ShortLinkService/internal/protect"
+	"github.com/ivanlp-p/ShortLinkService/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_passwordProtected(t *testing.T) {
+	cfg := config.Default()
+	cfg.RedirectStatus = http.StatusMovedPermanently
+	store := storage.NewMapStorage()
+	fileStorage := storage.NewFileStorage(filepath.Join(t.TempDir(), "db.json"), store)
+	gate := newPasswordGate([]byte("secret"), cfg.LinkPasswordMaxFailures)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	gate.now = func() time.Time { return now }
+	gate.throttle.Now = gate.now
+	gate.linkThrottle.Now = gate.now
+
+	w := httptest.NewRecorder()
+	body := strings.NewReader(`{"url": "https://intranet.example.com/plan", "password": "hunter2"}`)
+	PostShortenRequest(cfg, fileStorage, noBlocklist(t), nil)(w, httptest.NewRequest(http.MethodPost, "/api/shorten", body))
+	require.Equal(t, http.StatusCreated, w.Code)
+	var resp models.ShortURL
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	id := strings.TrimPrefix(resp.Result, cfg.BaseURL)
+
+	link, err := fileStorage.GetShortLink(context.Background(), id)
+	require.NoError(t, err)
+	assert.NotContains(t, link.PasswordHash, "hunter2")
+
+	h := handlerGet(cfg, fileStorage, noBlocklist(t), nil, gate, nil)
+	router := chi.NewRouter()
+	router.Get("/{id}", h)
+	router.Post("/{id}", h)
+
+	submit := func(password, ip string) *httptest.ResponseRecorder {
+		form := url.Values{"password": {password}}
+		request := httptest.NewRequest(http.MethodPost, "/"+id, strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w
+	}
+	get := func(target string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, target, nil)
+		for _, c := range cookies {
+			request.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w
+	}
+
+	t.Run("form", func(t *testing.T) {
+		w := get("/" + id)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Empty(t, w.Header().Get("Location"))
+		assert.Contains(t, w.Body.String(), `<form method="post" action="/`+id+`">`)
+		assert.NotContains(t, w.Body.String(), "intranet.example.com")
+
+		w = get("/" + id + "?preview=1")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.NotContains(t, w.Body.String(), "intranet.example.com")
+	})
+
+	t.Run("wrong_password", func(t *testing.T) {
+		w := submit("hunter3", "192.0.2.1")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "Wrong password")
+		assert.Empty(t, w.Result().Cookies())
+	})
+
+	var unlock *http.Cookie
+	t.Run("unlock", func(t *testing.T) {
+		w := submit("hunter2", "192.0.2.1")
+		require.Equal(t, http.StatusSeeOther, w.Code)
+		assert.Equal(t, "/"+id, w.Header().Get("Location"))
+		require.Len(t, w.Result().Cookies(), 1)
+		unlock = w.Result().Cookies()[0]
+		assert.Equal(t, "sl_unlock_"+id, unlock.Name)
+		assert.True(t, unlock.HttpOnly)
+
+		w = get("/"+id, unlock)
+		assert.Equal(t, http.StatusMovedPermanently, w.Code)
+		assert.Equal(t, "https://intranet.example.com/plan", w.Header().Get("Location"))
+		assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	})
+
+	t.Run("forged_cookie", func(t *testing.T) {
+		w := get("/"+id, &http.Cookie{Name: "sl_unlock_" + id, Value: "9999999999.forged"})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("cookie_expires", func(t *testing.T) {
+		now = now.Add(unlockCookieMaxAge)
+		w := get("/"+id, unlock)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("throttled", func(t *testing.T) {
+		for range maxPasswordFailures {
+			require.Equal(t, http.StatusUnauthorized, submit("guess", "198.51.100.7").Code)
+		}
+		w := submit("hunter2", "198.51.100.7")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "900", w.Header().Get("Retry-After"))
+
+		assert.Equal(t, http.StatusSeeOther, submit("hunter2", "192.0.2.1").Code, "other clients are not throttled")
+
+		now = now.Add(passwordFailureWindow)
+		assert.Equal(t, http.StatusSeeOther, submit("hunter2", "198.51.100.7").Code)
+	})
+
+	t.Run("spoofed_real_ip", func(t *testing.T) {
+		now = now.Add(passwordFailureWindow)
+		for i := range maxPasswordFailures {
+			w := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodPost, "/"+id, strings.NewReader(url.Values{"password": {"guess"}}.Encode()))
+			request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			request.Header.Set("X-Real-IP", fmt.Sprintf("203.0.113.%d", i))
+			request.RemoteAddr = "198.51.100.8:1234"
+			router.ServeHTTP(w, request)
+			require.Equal(t, http.StatusUnauthorized, w.Code)
+		}
+		assert.Equal(t, http.StatusTooManyRequests, submit("hunter2", "198.51.100.8").Code)
+	})
+
+	t.Run("concurrent_guesses", func(t *testing.T) {
+		now = now.Add(passwordFailureWindow)
+		var checked atomic.Int32
+		gate.check = func(ctx context.Context, hash, password string) (bool, error) {
+			checked.Add(1)
+			time.Sleep(time.Millisecond)
+			return false, nil
+		}
+		defer func() { gate.check = protect.CheckPassword }()
+
+		var wg sync.WaitGroup
+		for range 50 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				submit("guess", "198.51.100.9")
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, int32(maxPasswordFailures), checked.Load(), "parallel guesses must not bypass the limit")
+		assert.Equal(t, http.StatusTooManyRequests, submit("hunter2", "198.51.100.9").Code)
+	})
+
+	t.Run("link_cap", func(t *testing.T) {
+		now = now.Add(passwordFailureWindow)
+		w := submit("hunter2", "192.0.2.50")
+		require.Equal(t, http.StatusSeeOther, w.Code)
+		holder := w.Result().Cookies()[0]
+
+		// Каждая проверка пароля дорогая, поэтому лимит уменьшен
+		gate.linkThrottle.MaxFailures = 3
+		for i := range gate.linkThrottle.MaxFailures {
+			require.Equal(t, http.StatusUnauthorized, submit("guess", fmt.Sprintf("203.0.113.%d", i)).Code)
+		}
+		w = submit("hunter2", "192.0.2.99")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code, "failures from many addresses lock the link")
+		assert.Equal(t, "900", w.Header().Get("Retry-After"))
+		assert.Equal(t, http.StatusMovedPermanently, get("/"+id, holder).Code, "visitors with an access cookie are not locked out")
+
+		now = now.Add(passwordFailureWindow)
+		assert.Equal(t, http.StatusSeeOther, submit("hunter2", "192.0.2.99").Code)
+	})
+
+	t.Run("link_cap_disabled", func(t *testing.T) {
+		now = now.Add(passwordFailureWindow)
+		linkThrottle := gate.linkThrottle
+		gate.linkThrottle = nil
+		defer func() { gate.linkThrottle = linkThrottle }()
+
+		for i := range 2 * maxPasswordFailures {
+			require.Equal(t, http.StatusUnauthorized, submit("guess", fmt.Sprintf("203.0.113.%d", i)).Code)
+		}
+		assert.Equal(t, http.StatusSeeOther, submit("hunter2", "192.0.2.99").Code)
+	})
+
+	t.Run("no_flattening", func(t *testing.T) {
+		cfg := config.Default()
+		cfg.FlattenChains = true
+		w := httptest.NewRecorder()
+		body := strings.NewReader(`{"url": "` + resp.Result + `"}`)
+		PostShortenRequest(cfg, fileStorage, noBlocklist(t), nil)(w, httptest.NewRequest(http.MethodPost, "/api/shorten", body))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "password-protected")
+	})
+
+	t.Run("reshorten_keeps_password", func(t *testing.T) {
+		before, err := fileStorage.GetShortLink(context.Background(), id)
+		require.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		handler(cfg, fileStorage, noBlocklist(t), nil)(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://intranet.example.com/plan")))
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, resp.Result, w.Body.String())
+
+		tests := []struct {
+			name         string
+			body         string
+			expectedCode int
+		}{
+			{name: "plain", body: `{"url": "https://intranet.example.com/plan"}`, expectedCode: http.StatusCreated},
+			{name: "same_password", body: `{"url": "https://intranet.example.com/plan", "password": "hunter2"}`, expectedCode: http.StatusCreated},
+			{name: "other_password", body: `{"url": "https://intranet.example.com/plan", "password": "hunter3"}`, expectedCode: http.StatusConflict},
+			{name: "other_options", body: `{"url": "https://intranet.example.com/plan", "interstitial": true}`, expectedCode: http.StatusConflict},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				w := httptest.NewRecorder()
+				PostShortenRequest(cfg, fileStorage, noBlocklist(t), nil)(w, httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(tt.body)))
+				assert.Equal(t, tt.expectedCode, w.Code)
+				var existing models.ShortURL
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &existing))
+				assert.Equal(t, resp.Result, existing.Result)
+			})
+		}
+
+		after, err := fileStorage.GetShortLink(context.Background(), id)
+		require.NoError(t, err)
+		assert.Equal(t, before.PasswordHash, after.PasswordHash)
+		assert.Equal(t, before.Version, after.Version)
+		assert.Equal(t, http.StatusUnauthorized, get("/"+id).Code)
+	})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/ivanlp-p/ShortLinkService/cmd/config"
+	"github.com/ivanlp-p/ShortLinkService/internal/logger"
+	"github.com/ivanlp-p/ShortLinkService/internal/qr"
+	"github.com/ivanlp-p/ShortLinkService/internal/storage"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+)
+
+const (
+	qrDefaultSize = 256
+	qrMinSize     = 64
+	qrMaxSize     = 2048
+
+	// QR-код зависит только от короткого адреса и параметров, поэтому его
+	// можно кэшировать надолго.
+	qrCacheControl = "public, max-age=86400"
+)
+
+// handlerQR отдаёт QR-код с полным коротким адресом ссылки.
+// Параметры: format=png|svg, size — сторона в пикселях, ecc=L|M|Q|H.
+func handlerQR(cfg *config.Config, fileStorage *storage.FileStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		if _, err := fileStorage.GetOriginalURL(r.Context(), id); err != nil {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+
+		query := r.URL.Query()
+		format := query.Get("format")
+		if format == "" {
+			format = "png"
+		}
+		if format != "png" && format != "svg" {
+			http.Error(w, fmt.Sprintf("Bad Request: unsupported format %q", format), http.StatusBadRequest)
+			return
+		}
+
+		size := qrDefaultSize
+		if s := query.Get("size"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < qrMinSize || n > qrMaxSize {
+				http.Error(w, fmt.Sprintf("Bad Request: size must be between %d and %d", qrMinSize, qrMaxSize), http.StatusBadRequest)
+				return
+			}
+			size = n
+		}
+
+		level := qr.Medium
+		if s := query.Get("ecc"); s != "" {
+			l, err := qr.ParseLevel(s)
+			if err != nil {
+				http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			level = l
+		}
+
+		shortURL := cfg.BaseURL + id
+		sum := sha1.Sum([]byte(fmt.Sprintf("%s|%s|%d|%s", shortURL, format, size, level)))
+		etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+
+		w.Header().Set("Cache-Control", qrCacheControl)
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		code, err := qr.Encode([]byte(shortURL), level)
+		if err != nil {
+			logger.FromContext(r.Context()).Error("QR encoding failed", zap.String("id", id), zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var buf bytes.Buffer
+		if format == "svg" {
+			w.Header().Set("Content-Type", "image/svg+xml")
+			err = code.WriteSVG(&buf, size, qr.QuietZone)
+		} else {
+			w.Header().Set("Content-Type", "image/png")
+			err = code.WritePNG(&buf, size, qr.QuietZone)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+		w.WriteHeader(http.StatusOK)
+		w.Write(buf.Bytes())
+	}
+}
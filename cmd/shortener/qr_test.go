@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"github.com/go-chi/chi/v5"
+	"github.com/ivanlp-p/ShortLinkService/cmd/config"
+	"github.com/ivanlp-p/ShortLinkService/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func Test_handlerQR(t *testing.T) {
+	cfg := config.Default()
+	store := storage.NewMapStorage()
+	store.Set("-8eOIgoJ", "https://rcimbvs.com/iuymedy")
+	fileStorage := storage.NewFileStorage(filepath.Join(t.TempDir(), "db.json"), store)
+
+	tests := []struct {
+		name            string
+		id              string
+		query           string
+		expectedCode    int
+		expectedType    string
+		expectedContent string
+	}{
+		{
+			name:         "png_default",
+			id:           "-8eOIgoJ",
+			expectedCode: http.StatusOK,
+			expectedType: "image/png",
+		},
+		{
+			name:            "svg",
+			id:              "-8eOIgoJ",
+			query:           "?format=svg&size=512&ecc=h",
+			expectedCode:    http.StatusOK,
+			expectedType:    "image/svg+xml",
+			expectedContent: `width="512" height="512"`,
+		},
+		{
+			name:            "bad_format",
+			id:              "-8eOIgoJ",
+			query:           "?format=gif",
+			expectedCode:    http.StatusBadRequest,
+			expectedContent: "unsupported format",
+		},
+		{
+			name:            "bad_size",
+			id:              "-8eOIgoJ",
+			query:           "?size=10000",
+			expectedCode:    http.StatusBadRequest,
+			expectedContent: "size must be between",
+		},
+		{
+			name:            "bad_ecc",
+			id:              "-8eOIgoJ",
+			query:           "?ecc=Z",
+			expectedCode:    http.StatusBadRequest,
+			expectedContent: "error correction level",
+		},
+		{
+			name:         "unknown_link",
+			id:           "missing",
+			expectedCode: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := getQR(t, cfg, fileStorage, tt.id, tt.query, "")
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			if tt.expectedType != "" {
+				assert.Equal(t, tt.expectedType, w.Header().Get("Content-Type"))
+				assert.Equal(t, qrCacheControl, w.Header().Get("Cache-Control"))
+				assert.NotEmpty(t, w.Header().Get("ETag"))
+			}
+			assert.Contains(t, w.Body.String(), tt.expectedContent)
+		})
+	}
+
+	t.Run("png_size", func(t *testing.T) {
+		w := getQR(t, cfg, fileStorage, "-8eOIgoJ", "?size=300", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		img, err := png.Decode(w.Body)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, img.Bounds().Dx(), 300)
+		assert.Greater(t, img.Bounds().Dx(), 250)
+	})
+
+	t.Run("not_modified", func(t *testing.T) {
+		etag := getQR(t, cfg, fileStorage, "-8eOIgoJ", "", "").Header().Get("ETag")
+		w := getQR(t, cfg, fileStorage, "-8eOIgoJ", "", etag)
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Empty(t, w.Body.String())
+
+		w = getQR(t, cfg, fileStorage, "-8eOIgoJ", "?ecc=L", etag)
+		assert.Equal(t, http.StatusOK, w.Code, "other parameters must produce another ETag")
+	})
+}
+
+func getQR(t *testing.T, cfg *config.Config, fileStorage *storage.FileStorage, id, query, ifNoneMatch string) *httptest.ResponseRecorder {
+	t.Helper()
+	request := httptest.NewRequest(http.MethodGet, "/api/links/"+id+"/qr"+query, nil)
+	if ifNoneMatch != "" {
+		request.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", id)
+	request = request.WithContext(context.WithValue(request.Context(), chi.RouteCtxKey, rctx))
+
+	w := httptest.NewRecorder()
+	handlerQR(cfg, fileStorage)(w, request)
+	return w
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/ivanlp-p/ShortLinkService/cmd/config"
+	"github.com/ivanlp-p/ShortLinkService/internal/forward"
+	"github.com/ivanlp-p/ShortLinkService/internal/models"
+	"github.com/ivanlp-p/ShortLinkService/internal/protect"
+	"net/http"
+)
+
+// validateLinkOptions проверяет настройки ссылки из запроса на создание.
+func validateLinkOptions(opts models.OriginalURL) error {
+	var errs []error
+	if opts.RedirectStatus != 0 && !config.IsRedirectStatus(opts.RedirectStatus) {
+		errs = append(errs, fmt.Errorf("redirect status %d: must be one of 301, 302, 307, 308", opts.RedirectStatus))
+	}
+	if !forward.QueryPolicy(opts.ForwardQuery).Valid() {
+		errs = append(errs, fmt.Errorf("forward query %q: must be one of destination, incoming, append", opts.ForwardQuery))
+	}
+	if err := validateTargeting(opts.Targeting); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateVariants(opts.Variants); err != nil {
+		errs = append(errs, err)
+	}
+	if len(opts.Password) > protect.MaxPasswordLength {
+		errs = append(errs, protect.ErrPasswordLength)
+	}
+	if opts.MaxClicks < 0 {
+		errs = append(errs, fmt.Errorf("max clicks %d: must not be negative", opts.MaxClicks))
+	}
+	if opts.ActiveFrom != nil && opts.ActiveUntil != nil && !opts.ActiveUntil.After(*opts.ActiveFrom) {
+		errs = append(errs, errors.New("active_until must be after active_from"))
+	}
+	if err := validateDescription(opts); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// destination возвращает адрес, на который нужно перенаправить запрос r из
+// страны country по ссылке link, и имя выбранного варианта A/B-теста.
+func destination(r *http.Request, link models.ShortLink, country string) (string, string, error) {
+	target, variant := selectTarget(r, link, country)
+	target, err := forward.URL(target, chi.URLParam(r, "*"), r.URL.RawQuery, forward.Options{
+		Query: forward.QueryPolicy(link.ForwardQuery),
+		Path:  link.ForwardPath,
+	})
+	return target, variant, err
+}
+
+// redirectStatus возвращает код редиректа ссылки или код по умолчанию.
+func redirectStatus(cfg *config.Config, link models.ShortLink) int {
+	if link.RedirectStatus != 0 {
+		return link.RedirectStatus
+	}
+	return cfg.RedirectStatus
+}
+
+// redirectCacheControl разрешает браузерам кэшировать постоянные редиректы.
+// Временные редиректы и A/B-тесты не кэшируются, чтобы каждый переход
+// доходил до сервиса и попадал в статистику. Постоянные кэшируются только на
+// PermanentRedirectMaxAge: ссылку могут изменить или заблокировать в любой момент. Редиректы, зависящие от
+// посетителя, не кэшируются общими кэшами. Ссылки с паролем, лимитом
+// переходов или сроком действия не кэшируются вовсе: закэшированный редирект
+// обходил бы проверку cookie доступа, счётчик или срок.
+func redirectCacheControl(cfg *config.Config, link models.ShortLink, status int) string {
+	if len(link.Variants) > 0 || link.PasswordHash != "" || link.MaxClicks > 0 || link.ActiveUntil != nil {
+		return "no-store"
+	}
+	if status == http.StatusMovedPermanently || status == http.StatusPermanentRedirect {
+		scope := "public"
+		if !emptyTargeting(link.Targeting) {
+			scope = "private"
+		}
+		return fmt.Sprintf("%s, max-age=%d", scope, cfg.PermanentRedirectMaxAge)
+	}
+	return "no-store"
+}
+
+// exhausted сообщает, что лимит переходов по ссылке исчерпан.
+func exhausted(link models.ShortLink) bool {
+	return link.MaxClicks > 0 && link.Clicks >= link.MaxClicks
+}
+
+// writeGone отвечает на переход по ссылке с исчерпанным лимитом или истёкшим
+// сроком действия. Ответ не кэшируется: лимит и срок ссылки могут изменить.
+func writeGone(w http.ResponseWriter) {
+	w.Header().Set("Cache-Control", "no-store")
+	http.Error(w, "Gone", http.StatusGone)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ivanlp-p/ShortLinkService/cmd/config"
+	"github.com/ivanlp-p/ShortLinkService/internal/logger"
+	"github.com/ivanlp-p/ShortLinkService/internal/models"
+	"go.uber.org/zap"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// reloader перечитывает конфигурацию и применяет на лету те настройки,
+// которые не требуют перезапуска: уровень логирования, доверенную подсеть,
+// доверенные прокси и всё, что подписано через onReload.
+type reloader struct {
+	args   []string
+	getenv func(string) string
+
+	mu      sync.Mutex
+	current *config.Config
+	hooks   []func(next *config.Config) error
+
+	trustedSubnet  atomic.Pointer[net.IPNet]
+	trustedProxies atomic.Pointer[[]*net.IPNet]
+}
+
+func newReloader(cfg *config.Config, args []string, getenv func(string) string) *reloader {
+	rl := &reloader{
+		args:    args,
+		getenv:  getenv,
+		current: cfg,
+	}
+	rl.setTrustedSubnet(cfg.TrustedSubnet)
+	rl.setTrustedProxies(cfg.TrustedProxies)
+	return rl
+}
+
+// onReload регистрирует функцию, применяющую новую конфигурацию.
+// Ошибка хука не отменяет остальные изменения, а возвращается из Reload.
+func (rl *reloader) onReload(hook func(next *config.Config) error) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.hooks = append(rl.hooks, hook)
+}
+
+// Reload загружает конфигурацию заново и применяет безопасные изменения.
+// Возвращает список изменённых настроек, которые вступят в силу только после перезапуска.
+func (rl *reloader) Reload() ([]string, error) {
+	next, err := config.Load(rl.args, rl.getenv)
+	if err != nil {
+		logger.Log.Error("Config reload failed", zap.Error(err))
+		return nil, err
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	restartRequired := rl.current.RestartRequired(next)
+	if len(restartRequired) > 0 {
+		logger.Log.Warn("Config changes require restart and were not applied",
+			zap.Strings("fields", restartRequired))
+	}
+
+	if err := logger.SetLevel(next.LogLevel); err != nil {
+		return nil, err
+	}
+	rl.setTrustedSubnet(next.TrustedSubnet)
+	rl.setTrustedProxies(next.TrustedProxies)
+
+	var hookErrs []error
+	for _, hook := range rl.hooks {
+		if err := hook(next); err != nil {
+			hookErrs = append(hookErrs, err)
+		}
+	}
+
+	applied := rl.current.Reloaded(next)
+	rl.current = applied
+
+	if err := errors.Join(hookErrs...); err != nil {
+		logger.Log.Error("Config partially reloaded", zap.Error(err))
+		return restartRequired, err
+	}
+
+	logger.Log.Info("Config reloaded",
+		zap.String("log_level", applied.LogLevel),
+		zap.String("trusted_subnet", applied.TrustedSubnet),
+	)
+	return restartRequired, nil
+}
+
+func (rl *reloader) setTrustedSubnet(cidr string) {
+	if cidr == "" {
+		rl.trustedSubnet.Store(nil)
+		return
+	}
+	_, subnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		// Config.Validate не пропускает некорректный CIDR
+		rl.trustedSubnet.Store(nil)
+		return
+	}
+	rl.trustedSubnet.Store(subnet)
+}
+
+func (rl *reloader) setTrustedProxies(cidrs []string) {
+	var proxies []*net.IPNet
+	for _, cidr := range cidrs {
+		// Config.Validate не пропускает некорректный CIDR
+		if _, subnet, err := net.ParseCIDR(cidr); err == nil {
+			proxies = append(proxies, subnet)
+		}
+	}
+	rl.trustedProxies.Store(&proxies)
+}
+
+// fromProxy сообщает, пришёл ли запрос с адреса ip от доверенного прокси.
+func (rl *reloader) fromProxy(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, subnet := range *rl.trustedProxies.Load() {
+		if subnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// trusted сообщает, можно ли обращаться к служебным эндпоинтам с адреса ip.
+// Пустая доверенная подсеть закрывает доступ для всех.
+func (rl *reloader) trusted(ip net.IP) bool {
+	subnet := rl.trustedSubnet.Load()
+	return subnet != nil && ip != nil && subnet.Contains(ip)
+}
+
+// watchSignals перечитывает конфигурацию при получении SIGHUP.
+func (rl *reloader) watchSignals() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	for range sig {
+		logger.Log.Info("SIGHUP received, reloading config")
+		rl.Reload()
+	}
+}
+
+type clientIPKey struct{}
+
+// realIP определяет адрес клиента и кладёт его в контекст запроса для
+// clientIP. Заголовок X-Real-IP учитывается, только если запрос пришёл от
+// доверенного прокси: иначе любой клиент мог бы назваться адресом из
+// доверенной подсети.
+func (rl *reloader) realIP(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip := peerIP(r)
+		if rl.fromProxy(ip) {
+			if realIP := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); realIP != nil {
+				ip = realIP
+			}
+		}
+		h(w, r.WithContext(context.WithValue(r.Context(), clientIPKey{}, ip)))
+	}
+}
+
+// clientIP возвращает адрес клиента, определённый realIP, а без него — адрес
+// из RemoteAddr.
+func clientIP(r *http.Request) net.IP {
+	if ip, ok := r.Context().Value(clientIPKey{}).(net.IP); ok {
+		return ip
+	}
+	return peerIP(r)
+}
+
+// peerIP возвращает адрес, с которого установлено соединение.
+func peerIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return net.ParseIP(r.RemoteAddr)
+	}
+	return net.ParseIP(host)
+}
+
+// trustedOnly пропускает к h только запросы из доверенной подсети.
+func trustedOnly(rl *reloader, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !rl.trusted(clientIP(r)) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		h(w, r)
+	}
+}
+
+func handlerReloadConfig(rl *reloader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		restartRequired, err := rl.Reload()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		resp := models.ReloadResult{
+			Status:          "reloaded",
+			RestartRequired: restartRequired,
+		}
+
+		response, err := json.Marshal(resp)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(response)
+	}
+}
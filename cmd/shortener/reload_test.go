@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"github.com/ivanlp-p/ShortLinkService/cmd/config"
+	"github.com/ivanlp-p/ShortLinkService/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeConfig(t *testing.T, path string, body string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(body), 0644))
+}
+
+func Test_reloader_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeConfig(t, path, `{"log_level": "info", "server_address": ":8080"}`)
+
+	args := []string{"-c", path}
+	getenv := func(string) string { return "" }
+
+	cfg, err := config.Load(args, getenv)
+	require.NoError(t, err)
+	require.NoError(t, logger.SetLevel(cfg.LogLevel))
+
+	rl := newReloader(cfg, args, getenv)
+	assert.False(t, rl.trusted(clientIP(httptest.NewRequest(http.MethodPost, "/", nil))))
+
+	writeConfig(t, path, `{"log_level": "debug", "server_address": ":9090", "trusted_subnet": "192.0.2.0/24"}`)
+
+	restartRequired, err := rl.Reload()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"server_address"}, restartRequired)
+	assert.Equal(t, zapcore.DebugLevel, logger.Level.Level())
+	assert.Equal(t, ":8080", rl.current.Address, "listen address must not change without restart")
+
+	writeConfig(t, path, `{"log_level": "loud"}`)
+	_, err = rl.Reload()
+	require.Error(t, err)
+	assert.Equal(t, zapcore.DebugLevel, logger.Level.Level(), "invalid config must not be applied")
+}
+
+func Test_reloader_ReloadTwice(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeConfig(t, path, `{"server_address": ":8080", "geoip_path": "a.csv", "inactive_page": "a.html"}`)
+
+	args := []string{"-c", path}
+	getenv := func(string) string { return "" }
+
+	cfg, err := config.Load(args, getenv)
+	require.NoError(t, err)
+	rl := newReloader(cfg, args, getenv)
+	var applied []string
+	rl.onReload(func(next *config.Config) error {
+		applied = append(applied, next.GeoIPPath+" "+next.InactivePagePath)
+		return nil
+	})
+
+	writeConfig(t, path, `{"server_address": ":9090", "geoip_path": "b.csv", "inactive_page": "b.html"}`)
+	restartRequired, err := rl.Reload()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"server_address"}, restartRequired)
+
+	restartRequired, err = rl.Reload()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"server_address"}, restartRequired, "address is still not applied")
+	assert.Equal(t, []string{"b.csv b.html", "b.csv b.html"}, applied)
+	assert.Equal(t, ":8080", rl.current.Address)
+	assert.Equal(t, "b.csv", rl.current.GeoIPPath, "hook-applied settings must be current")
+	assert.Equal(t, "b.html", rl.current.InactivePagePath)
+
+	writeConfig(t, path, `{"server_address": ":8080", "geoip_path": "b.csv", "inactive_page": "b.html"}`)
+	restartRequired, err = rl.Reload()
+	require.NoError(t, err)
+	assert.Empty(t, restartRequired, "reverted address needs no restart")
+}
+
+func Test_handlerReloadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeConfig(t, path, `{"trusted_subnet": "192.0.2.0/24", "trusted_proxies": ["10.0.0.0/8"]}`)
+
+	args := []string{"-c", path}
+	getenv := func(string) string { return "" }
+
+	cfg, err := config.Load(args, getenv)
+	require.NoError(t, err)
+	rl := newReloader(cfg, args, getenv)
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		realIP       string
+		expectedCode int
+	}{
+		{
+			name:         "trusted",
+			remoteAddr:   "192.0.2.10:1234",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "untrusted",
+			remoteAddr:   "198.51.100.1:1234",
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "spoofed_real_ip",
+			remoteAddr:   "198.51.100.1:1234",
+			realIP:       "192.0.2.10",
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "trusted_via_proxy",
+			remoteAddr:   "10.1.2.3:1234",
+			realIP:       "192.0.2.10",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "untrusted_via_proxy",
+			remoteAddr:   "10.1.2.3:1234",
+			realIP:       "198.51.100.1",
+			expectedCode: http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/api/internal/config/reload", bytes.NewBufferString(""))
+			request.RemoteAddr = tt.remoteAddr
+			if tt.realIP != "" {
+				request.Header.Set("X-Real-IP", tt.realIP)
+			}
+			w := httptest.NewRecorder()
+			rl.realIP(trustedOnly(rl, handlerReloadConfig(rl)))(w, request)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+		})
+	}
+}
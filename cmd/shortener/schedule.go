@@ -0,0 +1,38 @@
+package main
+
+import (
+	"github.com/ivanlp-p/ShortLinkService/cmd/config"
+	"github.com/ivanlp-p/ShortLinkService/internal/models"
+	"github.com/ivanlp-p/ShortLinkService/internal/schedule"
+	"net/http"
+	"time"
+)
+
+// scheduler проверяет окно действия ссылок. Часы подменяются в тестах;
+// nil-значение использует системное время и отвечает 404 без страницы.
+type scheduler struct {
+	page *schedule.Page
+	now  func() time.Time
+}
+
+func newScheduler(page *schedule.Page) *scheduler {
+	return &scheduler{page: page, now: time.Now}
+}
+
+// state возвращает состояние ссылки на текущий момент.
+func (s *scheduler) state(link models.ShortLink) schedule.State {
+	now := time.Now
+	if s != nil {
+		now = s.now
+	}
+	return schedule.Of(link.ActiveFrom, link.ActiveUntil, now())
+}
+
+// writePending отвечает на переход по ссылке, которая ещё не начала действовать.
+func (s *scheduler) writePending(w http.ResponseWriter, cfg *config.Config, link models.ShortLink) {
+	var page *schedule.Page
+	if s != nil {
+		page = s.page
+	}
+	page.Write(w, schedule.PageData{ShortURL: cfg.BaseURL + link.ShortURL, ActiveFrom: *link.ActiveFrom})
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ivanlp-p/ShortLinkService/cmd/config"
+	"github.com/ivanlp-p/ShortLinkService/internal/models"
+	"github.com/ivanlp-p/ShortLinkService/internal/schedule"
+	"github.com/ivanlp-p/ShortLinkService/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_schedule(t *testing.T) {
+	cfg := config.Default()
+	fileStorage := storage.NewFileStorage(filepath.Join(t.TempDir(), "db.json"), storage.NewMapStorage())
+
+	w := httptest.NewRecorder()
+	body := strings.NewReader(`{"url": "https://example.com/launch", "active_from": "2024-06-01T10:00:00Z", "active_until": "2024-06-08T10:00:00+02:00"}`)
+	PostShortenRequest(cfg, fileStorage, noBlocklist(t), nil)(w, httptest.NewRequest(http.MethodPost, "/api/shorten", body))
+	require.Equal(t, http.StatusCreated, w.Code)
+	var resp models.ShortURL
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	id := strings.TrimPrefix(resp.Result, cfg.BaseURL)
+
+	pagePath := filepath.Join(t.TempDir(), "soon.html")
+	require.NoError(t, os.WriteFile(pagePath, []byte(`<h1>Coming {{.ActiveFrom.Format "Jan 2 15:04 MST"}}</h1>`), 0644))
+	page, err := schedule.NewPage(pagePath)
+	require.NoError(t, err)
+
+	var now time.Time
+	sched := newScheduler(page)
+	sched.now = func() time.Time { return now }
+	h := handlerGet(cfg, fileStorage, noBlocklist(t), nil, nil, sched)
+
+	tests := []struct {
+		name             string
+		now              time.Time
+		expectedCode     int
+		expectedLocation string
+		expectedBody     string
+	}{
+		{
+			name:         "not_yet_active",
+			now:          time.Date(2024, 6, 1, 9, 59, 59, 0, time.UTC),
+			expectedCode: http.StatusNotFound,
+			expectedBody: "<h1>Coming Jun 1 10:00 UTC</h1>",
+		},
+		{
+			name:             "goes_live",
+			now:              time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC),
+			expectedCode:     http.StatusTemporaryRedirect,
+			expectedLocation: "https://example.com/launch",
+		},
+		{
+			name:             "last_second",
+			now:              time.Date(2024, 6, 8, 7, 59, 59, 0, time.UTC),
+			expectedCode:     http.StatusTemporaryRedirect,
+			expectedLocation: "https://example.com/launch",
+		},
+		{
+			name:         "expired",
+			now:          time.Date(2024, 6, 8, 8, 0, 0, 0, time.UTC),
+			expectedCode: http.StatusGone,
+			expectedBody: "Gone\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = tt.now
+			w := getLink(t, h, id)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.Equal(t, tt.expectedLocation, w.Header().Get("Location"))
+			assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+			if tt.expectedBody != "" {
+				assert.Equal(t, tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+
+	t.Run("default_page", func(t *testing.T) {
+		now = time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+		h := handlerGet(cfg, fileStorage, noBlocklist(t), nil, nil, &scheduler{now: sched.now})
+		w := getLink(t, h, id+"+")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "Not Found\n", w.Body.String())
+	})
+
+	t.Run("clicks", func(t *testing.T) {
+		stats, err := fileStorage.GetStats(context.Background(), id)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), stats.Clicks, "only active redirects are counted")
+	})
+
+	t.Run("invalid_window", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		body := strings.NewReader(`{"url": "https://example.com/", "active_from": "2024-06-01T10:00:00Z", "active_until": "2024-06-01T10:00:00Z"}`)
+		PostShortenRequest(cfg, fileStorage, noBlocklist(t), nil)(w, httptest.NewRequest(http.MethodPost, "/api/shorten", body))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "active_until must be after active_from")
+	})
+}
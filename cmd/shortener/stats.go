@@ -0,0 +1,29 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/ivanlp-p/ShortLinkService/internal/storage"
+	"net/http"
+)
+
+// handlerStats отдаёт статистику переходов по ссылке, в том числе по вариантам A/B-теста.
+func handlerStats(fileStorage *storage.FileStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stats, err := fileStorage.GetStats(r.Context(), chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+
+		response, err := json.MarshalIndent(stats, "", "   ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		w.Write(response)
+	}
+}
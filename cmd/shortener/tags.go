@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ivanlp-p/ShortLinkService/cmd/config"
+	"github.com/ivanlp-p/ShortLinkService/internal/auth"
+	"github.com/ivanlp-p/ShortLinkService/internal/models"
+	"github.com/ivanlp-p/ShortLinkService/internal/storage"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	maxTitleLength = 200
+	maxNotesLength = 2000
+	maxTags        = 20
+	maxTagLength   = 32
+)
+
+// validateDescription проверяет название, заметки и метки ссылки. Метки
+// сравниваются без учёта регистра и пробелов по краям, как после normalizeTags.
+func validateDescription(opts models.OriginalURL) error {
+	var errs []error
+	if n := utf8.RuneCountInString(opts.Title); n > maxTitleLength {
+		errs = append(errs, fmt.Errorf("title: %d characters, at most %d allowed", n, maxTitleLength))
+	}
+	if n := utf8.RuneCountInString(opts.Notes); n > maxNotesLength {
+		errs = append(errs, fmt.Errorf("notes: %d characters, at most %d allowed", n, maxNotesLength))
+	}
+	if n := len(normalizeTags(opts.Tags)); n > maxTags {
+		errs = append(errs, fmt.Errorf("tags: %d tags, at most %d allowed", n, maxTags))
+	}
+	for _, tag := range opts.Tags {
+		if err := validateTag(strings.ToLower(strings.TrimSpace(tag))); err != nil {
+			errs = append(errs, fmt.Errorf("tag %q: %w", tag, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateTag проверяет нормализованную метку: буквы, цифры, «-», «_» и «.».
+func validateTag(tag string) error {
+	if tag == "" {
+		return errors.New("must not be empty")
+	}
+	if utf8.RuneCountInString(tag) > maxTagLength {
+		return fmt.Errorf("at most %d characters allowed", maxTagLength)
+	}
+	for _, r := range tag {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' && r != '.' {
+			return errors.New("only letters, digits, '-', '_' and '.' are allowed")
+		}
+	}
+	return nil
+}
+
+// normalizeTags приводит метки к нижнему регистру, убирает повторы и
+// сортирует, чтобы «Promo» и «promo » были одной меткой в индексе.
+func normalizeTags(tags []string) []string {
+	var normalized []string
+	for _, tag := range tags {
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" {
+			normalized = append(normalized, tag)
+		}
+	}
+	slices.Sort(normalized)
+	return slices.Compact(normalized)
+}
+
+// handlerUserURLs возвращает ссылки пользователя, от новых к старым.
+// Параметр tag оставляет ссылки с этой меткой, q — ссылки, в названии или
+// исходном адресе которых есть подстрока без учёта регистра. Пользователю
+// принадлежат только созданные им ссылки: на адрес, который уже сократил
+// кто-то другой, он получает свою ссылку, а чужая в список не попадает.
+func handlerUserURLs(cfg *config.Config, fileStorage *storage.FileStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := auth.UserID(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		filter := models.LinkFilter{
+			UserID: userID,
+			Tag:    strings.ToLower(strings.TrimSpace(r.URL.Query().Get("tag"))),
+			Query:  strings.TrimSpace(r.URL.Query().Get("q")),
+		}
+
+		links := fileStorage.FindShortLinks(r.Context(), filter)
+		infos := make([]models.LinkInfo, 0, len(links))
+		for _, link := range links {
+			infos = append(infos, linkInfo(cfg, link))
+		}
+		response, err := json.MarshalIndent(infos, "", "   ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(response)
+	}
+}
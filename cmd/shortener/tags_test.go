@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/ivanlp-p/ShortLinkService/cmd/config"
+	"github.com/ivanlp-p/ShortLinkService/internal/auth"
+	"github.com/ivanlp-p/ShortLinkService/internal/models"
+	"github.com/ivanlp-p/ShortLinkService/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_userURLs(t *testing.T) {
+	cfg := config.Default()
+	dbPath := filepath.Join(t.TempDir(), "db.json")
+	fileStorage := storage.NewFileStorage(dbPath, storage.NewMapStorage())
+	bl := noBlocklist(t)
+	authn := auth.New([]byte("key"))
+	alice, bob := authn.Cookie("alice"), authn.Cookie("bob")
+
+	newRouter := func(fileStorage *storage.FileStorage) *chi.Mux {
+		router := chi.NewRouter()
+		router.Post("/api/shorten", authn.Handler(PostShortenRequest(cfg, fileStorage, bl, nil)))
+		router.Patch("/api/links/{id}", authn.Handler(handlerPatch(cfg, fileStorage, bl, nil)))
+		router.Get("/api/user/urls", authn.Handler(handlerUserURLs(cfg, fileStorage)))
+		return router
+	}
+	router := newRouter(fileStorage)
+
+	send := func(router http.Handler, method, target, body string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		request.Header.Set("If-Match", "*")
+		request.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w
+	}
+	create := func(body string, cookie *http.Cookie) string {
+		w := send(router, http.MethodPost, "/api/shorten", body, cookie)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var resp models.ShortURL
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return strings.TrimPrefix(resp.Result, cfg.BaseURL)
+	}
+
+	spring := create(`{"url": "https://shop.example.com/spring", "title": "Spring Sale", "notes": "email campaign", "tags": ["Promo", " email ", "promo"]}`, alice)
+	docs := create(`{"url": "https://docs.example.com/start", "title": "Getting started", "tags": ["docs"]}`, alice)
+	bobSale := create(`{"url": "https://shop.example.com/bob", "title": "Bob's sale", "tags": ["promo"]}`, bob)
+
+	list := func(t *testing.T, router http.Handler, query string, cookie *http.Cookie) []string {
+		t.Helper()
+		w := send(router, http.MethodGet, "/api/user/urls"+query, "", cookie)
+		require.Equal(t, http.StatusOK, w.Code)
+		var infos []models.LinkInfo
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &infos))
+		ids := []string{}
+		for _, info := range infos {
+			ids = append(ids, strings.TrimPrefix(info.ShortURL, cfg.BaseURL))
+		}
+		return ids
+	}
+
+	link, err := fileStorage.GetShortLink(context.Background(), spring)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"email", "promo"}, link.Tags)
+	assert.Equal(t, "email campaign", link.Notes)
+
+	tests := []struct {
+		name        string
+		query       string
+		cookie      *http.Cookie
+		expectedIDs []string
+	}{
+		{name: "all", cookie: alice, expectedIDs: []string{spring, docs}},
+		{name: "tag", query: "?tag=promo", cookie: alice, expectedIDs: []string{spring}},
+		{name: "tag_case", query: "?tag=PROMO", cookie: alice, expectedIDs: []string{spring}},
+		{name: "title", query: "?q=sale", cookie: alice, expectedIDs: []string{spring}},
+		{name: "original_url", query: "?q=DOCS.example", cookie: alice, expectedIDs: []string{docs}},
+		{name: "notes_not_searched", query: "?q=campaign", cookie: alice, expectedIDs: []string{}},
+		{name: "tag_and_query", query: "?tag=docs&q=sale", cookie: alice, expectedIDs: []string{}},
+		{name: "other_user", query: "?tag=promo", cookie: bob, expectedIDs: []string{bobSale}},
+		{name: "new_user", cookie: authn.Cookie("carol"), expectedIDs: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ElementsMatch(t, tt.expectedIDs, list(t, router, tt.query, tt.cookie))
+		})
+	}
+
+	t.Run("same_url_other_user", func(t *testing.T) {
+		bobDocs := create(`{"url": "https://docs.example.com/start", "title": "Bob's docs", "tags": ["bob"]}`, bob)
+		assert.NotEqual(t, docs, bobDocs, "other users get their own link")
+
+		assert.NotContains(t, list(t, router, "", bob), docs)
+		assert.Equal(t, []string{bobDocs}, list(t, router, "?tag=bob", bob))
+		assert.Contains(t, list(t, router, "?tag=docs", alice), docs)
+		assert.NotContains(t, list(t, router, "", alice), bobDocs)
+		link, err := fileStorage.GetShortLink(context.Background(), docs)
+		require.NoError(t, err)
+		assert.Equal(t, "alice", link.UserID)
+		assert.Equal(t, "Getting started", link.Title)
+	})
+
+	t.Run("retag", func(t *testing.T) {
+		w := send(router, http.MethodPatch, "/api/links/"+spring, `{"tags": ["archive"], "title": "Old sale"}`, alice)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		assert.Empty(t, list(t, router, "?tag=promo", alice))
+		assert.Equal(t, []string{spring}, list(t, router, "?tag=archive", alice))
+		assert.Equal(t, []string{spring}, list(t, router, "?q=old", alice))
+	})
+
+	t.Run("restart", func(t *testing.T) {
+		restarted := storage.NewFileStorage(dbPath, storage.NewMapStorage())
+		require.NoError(t, restarted.LoadFromFile(context.Background()))
+		router := newRouter(restarted)
+
+		assert.Equal(t, []string{spring}, list(t, router, "?tag=archive", alice))
+		assert.Empty(t, list(t, router, "?tag=promo", alice))
+		assert.ElementsMatch(t, []string{spring, docs}, list(t, router, "", alice))
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		body := `{"url": "https://example.com/", "title": "` + strings.Repeat("x", maxTitleLength+1) + `", "tags": ["ok", "no spaces", ""]}`
+		w := send(router, http.MethodPost, "/api/shorten", body, alice)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "title: 201 characters")
+		assert.Contains(t, w.Body.String(), `tag "no spaces"`)
+		assert.Contains(t, w.Body.String(), `tag "": must not be empty`)
+	})
+}
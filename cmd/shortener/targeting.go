@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/ivanlp-p/ShortLinkService/cmd/config"
+	"github.com/ivanlp-p/ShortLinkService/internal/acceptlang"
+	"github.com/ivanlp-p/ShortLinkService/internal/audit"
+	"github.com/ivanlp-p/ShortLinkService/internal/blocklist"
+	"github.com/ivanlp-p/ShortLinkService/internal/geoip"
+	"github.com/ivanlp-p/ShortLinkService/internal/limits"
+	"github.com/ivanlp-p/ShortLinkService/internal/models"
+	"github.com/ivanlp-p/ShortLinkService/internal/storage"
+	"github.com/ivanlp-p/ShortLinkService/internal/useragent"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// validateTargeting проверяет условия правил; адреса проверяет urlChecker.
+func validateTargeting(t *models.Targeting) error {
+	if t == nil {
+		return nil
+	}
+	var errs []error
+	for i, rule := range t.Device {
+		if rule.URL == "" {
+			errs = append(errs, fmt.Errorf("device rule %d: url must not be empty", i))
+		}
+		if rule.OS != "" && !useragent.KnownOS(rule.OS) {
+			errs = append(errs, fmt.Errorf("device rule %d: unknown os %q", i, rule.OS))
+		}
+		if rule.Device != "" && !useragent.KnownDevice(rule.Device) {
+			errs = append(errs, fmt.Errorf("device rule %d: unknown device %q", i, rule.Device))
+		}
+	}
+	for i := range t.Country {
+		rule := &t.Country[i]
+		if rule.URL == "" {
+			errs = append(errs, fmt.Errorf("country rule %d: url must not be empty", i))
+		}
+		if len(rule.Countries) == 0 {
+			errs = append(errs, fmt.Errorf("country rule %d: countries must not be empty", i))
+		}
+		for j, c := range rule.Countries {
+			rule.Countries[j] = strings.ToUpper(c)
+			if !geoip.ValidCountry(rule.Countries[j]) {
+				errs = append(errs, fmt.Errorf("country rule %d: country %q must be a two-letter ISO 3166 code", i, c))
+			}
+		}
+	}
+	seen := make(map[string]int)
+	for i := range t.Language {
+		rule := &t.Language[i]
+		if rule.URL == "" {
+			errs = append(errs, fmt.Errorf("language rule %d: url must not be empty", i))
+		}
+		if len(rule.Languages) == 0 {
+			errs = append(errs, fmt.Errorf("language rule %d: languages must not be empty", i))
+		}
+		for _, lang := range rule.Languages {
+			if !acceptlang.ValidTag(lang) {
+				errs = append(errs, fmt.Errorf("language rule %d: invalid language tag %q", i, lang))
+				continue
+			}
+			// Один язык в двух правилах сделал бы выбор зависимым от порядка
+			key := strings.ToLower(lang)
+			if prev, ok := seen[key]; ok && prev != i {
+				errs = append(errs, fmt.Errorf("language rule %d: language %q already used in rule %d", i, lang, prev))
+			}
+			seen[key] = i
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// emptyTargeting сообщает, что в t нет ни одного правила.
+func emptyTargeting(t *models.Targeting) bool {
+	return t == nil || len(t.Device) == 0 && len(t.Country) == 0 && len(t.Language) == 0
+}
+
+// selectTarget возвращает адрес назначения, выбранный для запроса r из
+// страны country. Правила проверяются в порядке: устройство, страна, язык;
+// если ни одно не подошло — вариант A/B-теста, иначе OriginalURL.
+// variant — имя выбранного варианта или пустая строка.
+func selectTarget(r *http.Request, link models.ShortLink, country string) (target string, variant string) {
+	if link.Targeting != nil && len(link.Targeting.Device) > 0 {
+		info := useragent.Parse(r.UserAgent())
+		for _, rule := range link.Targeting.Device {
+			if matchDevice(rule, info) {
+				return rule.URL, ""
+			}
+		}
+	}
+	if link.Targeting != nil && country != "" {
+		for _, rule := range link.Targeting.Country {
+			if slices.Contains(rule.Countries, country) {
+				return rule.URL, ""
+			}
+		}
+	}
+	if link.Targeting != nil && len(link.Targeting.Language) > 0 {
+		if url, ok := matchLanguage(r.Header.Get("Accept-Language"), link.Targeting.Language); ok {
+			return url, ""
+		}
+	}
+	if v, ok := chooseVariant(r, link); ok {
+		return v.URL, v.Name
+	}
+	return link.OriginalURL, ""
+}
+
+func matchDevice(rule models.DeviceRule, info useragent.Info) bool {
+	return (rule.OS == "" || rule.OS == info.OS) &&
+		(rule.Device == "" || rule.Device == info.Device) &&
+		(rule.Bot == nil || *rule.Bot == info.Bot)
+}
+
+// matchLanguage выбирает правило, язык которого лучше всего подходит под
+// заголовок Accept-Language.
+func matchLanguage(header string, rules []models.LanguageRule) (string, bool) {
+	var (
+		langs []string
+		owner []int
+	)
+	for i, rule := range rules {
+		for _, lang := range rule.Languages {
+			langs = append(langs, lang)
+			owner = append(owner, i)
+		}
+	}
+	i, ok := acceptlang.Match(header, langs)
+	if !ok {
+		return "", false
+	}
+	return rules[owner[i]].URL, true
+}
+
+// varyHeaders возвращает заголовки запроса, от которых зависит выбор адреса назначения.
+func varyHeaders(link models.ShortLink) []string {
+	var headers []string
+	if link.Targeting != nil && len(link.Targeting.Device) > 0 {
+		headers = append(headers, "User-Agent")
+	}
+	if link.Targeting != nil && len(link.Targeting.Language) > 0 {
+		headers = append(headers, "Accept-Language")
+	}
+	if link.StickyVariant && len(link.Variants) > 0 {
+		headers = append(headers, "Cookie")
+	}
+	return headers
+}
+
+// handlerTargeting заменяет правила выбора адреса назначения у существующей
+// ссылки. Как и при редактировании, нужен If-Match с ETag текущей версии,
+// чтобы не затереть одновременную правку владельца.
+func handlerTargeting(cfg *config.Config, fileStorage *storage.FileStorage, bl *blocklist.Blocklist, al *audit.Log) http.HandlerFunc {
+	checker := newURLChecker(cfg, bl, fileStorage)
+	return func(w http.ResponseWriter, r *http.Request) {
+		link, err := fileStorage.GetShortLink(r.Context(), chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		version, ok := ifMatchVersion(w, r, link)
+		if !ok {
+			return
+		}
+
+		var targeting models.Targeting
+		if err := json.NewDecoder(r.Body).Decode(&targeting); err != nil {
+			if limit, ok := limits.IsTooLarge(err); ok {
+				limits.TooLarge(w, "request body", limit)
+				return
+			}
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := validateTargeting(&targeting); err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !checker.checkTargeting(r.Context(), w, &targeting) {
+			return
+		}
+
+		updatedBy := actor(r)
+		var before models.ShortLink
+		updated, err := fileStorage.UpdateShortLink(r.Context(), link.ShortURL, version, func(current models.ShortLink) (models.ShortLink, error) {
+			before = current
+			current.Targeting = &targeting
+			if emptyTargeting(&targeting) {
+				current.Targeting = nil
+			}
+			current.UpdatedBy = updatedBy
+			return current, nil
+		})
+		if !writeUpdateError(w, updated, err) {
+			return
+		}
+		recordAudit(r, al, cfg, audit.ActionTargeting, &before, updated)
+
+		response, err := json.MarshalIndent(targeting, "", "   ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", linkETag(updated))
+		w.WriteHeader(http.StatusOK)
+		w.Write(response)
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"github.com/go-chi/chi/v5"
+	"github.com/ivanlp-p/ShortLinkService/cmd/config"
+	"github.com/ivanlp-p/ShortLinkService/internal/geoip"
+	"github.com/ivanlp-p/ShortLinkService/internal/models"
+	"github.com/ivanlp-p/ShortLinkService/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	uaIPhone    = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1"
+	uaAndroid   = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36"
+	uaWindows   = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"
+	uaGooglebot = "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
+)
+
+func Test_deviceTargeting(t *testing.T) {
+	cfg := config.Default()
+	store := storage.NewMapStorage()
+	bot := true
+	store.Put(models.ShortLink{
+		ShortURL:    "app",
+		OriginalURL: "https://example.com/app",
+		Targeting: &models.Targeting{Device: []models.DeviceRule{
+			{Bot: &bot, URL: "https://example.com/app?crawler"},
+			{OS: "ios", URL: "https://apps.apple.com/app/id1"},
+			{OS: "android", Device: "mobile", URL: "https://play.google.com/store/apps/details?id=app"},
+		}},
+	})
+	fileStorage := storage.NewFileStorage(filepath.Join(t.TempDir(), "db.json"), store)
+
+	tests := []struct {
+		name             string
+		userAgent        string
+		expectedLocation string
+	}{
+		{name: "ios", userAgent: uaIPhone, expectedLocation: "https://apps.apple.com/app/id1"},
+		{name: "android", userAgent: uaAndroid, expectedLocation: "https://play.google.com/store/apps/details?id=app"},
+		{name: "fallback", userAgent: uaWindows, expectedLocation: "https://example.com/app"},
+		{name: "bot_rule_first", userAgent: uaGooglebot, expectedLocation: "https://example.com/app?crawler"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/app", nil)
+			request.Header.Set("User-Agent", tt.userAgent)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", "app")
+			request = request.WithContext(context.WithValue(request.Context(), chi.RouteCtxKey, rctx))
+
+			w := httptest.NewRecorder()
+			handlerGet(cfg, fileStorage, noBlocklist(t), nil, nil, nil)(w, request)
+
+			assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+			assert.Equal(t, tt.expectedLocation, w.Header().Get("Location"))
+			assert.Equal(t, "User-Agent", w.Header().Get("Vary"))
+		})
+	}
+}
+
+func Test_handlerTargeting(t *testing.T) {
+	cfg := config.Default()
+	store := storage.NewMapStorage()
+	store.Set("app", "https://example.com/app")
+	fileStorage := storage.NewFileStorage(filepath.Join(t.TempDir(), "db.json"), store)
+
+	tests := []struct {
+		name         string
+		id           string
+		body         string
+		ifMatch      string
+		expectedCode int
+		expectedBody string
+		expectedURL  string
+	}{
+		{
+			name:         "no_if_match",
+			id:           "app",
+			body:         `{"device": [{"os": "ios", "url": "https://apps.apple.com/app/id0"}]}`,
+			expectedCode: http.StatusPreconditionRequired,
+			expectedBody: "If-Match",
+		},
+		{
+			name:         "replace",
+			id:           "app",
+			body:         `{"device": [{"os": "ios", "url": "HTTPS://Apps.Apple.com/app/id1"}]}`,
+			ifMatch:      `"v0"`,
+			expectedCode: http.StatusOK,
+			expectedURL:  "https://apps.apple.com/app/id1",
+		},
+		{
+			name:         "lost_update",
+			id:           "app",
+			body:         `{"device": [{"os": "android", "url": "https://play.google.com/store/apps/details?id=app"}]}`,
+			ifMatch:      `"v0"`,
+			expectedCode: http.StatusPreconditionFailed,
+			expectedBody: "current version is 1",
+			expectedURL:  "https://apps.apple.com/app/id1",
+		},
+		{
+			name:         "unknown_os",
+			id:           "app",
+			ifMatch:      "*",
+			body:         `{"device": [{"os": "symbian", "url": "https://example.com/"}, {"device": "watch", "url": ""}]}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `unknown os "symbian"`,
+		},
+		{
+			name:         "invalid_url",
+			id:           "app",
+			ifMatch:      "*",
+			body:         `{"device": [{"os": "ios", "url": "javascript:alert(1)"}]}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "invalid URL",
+		},
+		{
+			name:         "unknown_link",
+			id:           "missing",
+			body:         `{}`,
+			expectedCode: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPut, "/api/links/"+tt.id+"/targeting", strings.NewReader(tt.body))
+			if tt.ifMatch != "" {
+				request.Header.Set("If-Match", tt.ifMatch)
+			}
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", tt.id)
+			request = request.WithContext(context.WithValue(request.Context(), chi.RouteCtxKey, rctx))
+
+			w := httptest.NewRecorder()
+			handlerTargeting(cfg, fileStorage, noBlocklist(t), nil)(w, request)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.Contains(t, w.Body.String(), tt.expectedBody)
+			if tt.expectedURL != "" {
+				link, err := fileStorage.GetShortLink(context.Background(), tt.id)
+				require.NoError(t, err)
+				require.NotNil(t, link.Targeting)
+				assert.Equal(t, tt.expectedURL, link.Targeting.Device[0].URL)
+			}
+		})
+	}
+}
+
+func Test_countryTargeting(t *testing.T) {
+	cfg := config.Default()
+	store := storage.NewMapStorage()
+	store.Put(models.ShortLink{
+		ShortURL:    "shop",
+		OriginalURL: "https://example.com/shop",
+		Targeting: &models.Targeting{Country: []models.CountryRule{
+			{Countries: []string{"DE", "AT"}, URL: "https://example.de/shop"},
+			{Countries: []string{"FR"}, URL: "https://example.fr/shop"},
+		}},
+	})
+	fileStorage := storage.NewFileStorage(filepath.Join(t.TempDir(), "db.json"), store)
+
+	path := filepath.Join(t.TempDir(), "geo.csv")
+	require.NoError(t, os.WriteFile(path, []byte("203.0.113.0/25,DE\n203.0.113.128/25,FR\n198.51.100.0,198.51.100.255,US\n"), 0644))
+	geo, err := geoip.New(path)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name             string
+		realIP           string
+		expectedLocation string
+	}{
+		{name: "de", realIP: "203.0.113.10", expectedLocation: "https://example.de/shop"},
+		{name: "fr", realIP: "203.0.113.200", expectedLocation: "https://example.fr/shop"},
+		{name: "no_rule", realIP: "198.51.100.1", expectedLocation: "https://example.com/shop"},
+		{name: "unknown_ip", realIP: "192.0.2.1", expectedLocation: "https://example.com/shop"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/shop", nil)
+			request.RemoteAddr = tt.realIP + ":1234"
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", "shop")
+			request = request.WithContext(context.WithValue(request.Context(), chi.RouteCtxKey, rctx))
+
+			w := httptest.NewRecorder()
+			handlerGet(cfg, fileStorage, noBlocklist(t), geo, nil, nil)(w, request)
+
+			assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+			assert.Equal(t, tt.expectedLocation, w.Header().Get("Location"))
+		})
+	}
+
+	stats, err := fileStorage.GetStats(context.Background(), "shop")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), stats.Clicks)
+	assert.Equal(t, map[string]int64{"DE": 1, "FR": 1, "US": 1}, stats.Countries)
+
+	t.Run("validation", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		body := strings.NewReader(`{"url": "https://example.com/", "targeting": {"country": [{"countries": ["de", "Germany"], "url": "https://example.de/"}, {"url": "https://example.fr/"}]}}`)
+		PostShortenRequest(cfg, fileStorage, noBlocklist(t), nil)(w, httptest.NewRequest(http.MethodPost, "/api/shorten", body))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `country "Germany"`)
+		assert.Contains(t, w.Body.String(), "countries must not be empty")
+	})
+}
+
+func Test_languageTargeting(t *testing.T) {
+	cfg := config.Default()
+	store := storage.NewMapStorage()
+	store.Put(models.ShortLink{
+		ShortURL:    "docs",
+		OriginalURL: "https://docs.example.com/en/",
+		Targeting: &models.Targeting{Language: []models.LanguageRule{
+			{Languages: []string{"de"}, URL: "https://docs.example.com/de/"},
+			{Languages: []string{"pt-BR", "pt-PT"}, URL: "https://docs.example.com/pt/"},
+		}},
+	})
+	fileStorage := storage.NewFileStorage(filepath.Join(t.TempDir(), "db.json"), store)
+
+	tests := []struct {
+		name             string
+		acceptLanguage   string
+		expectedLocation string
+	}{
+		{name: "exact", acceptLanguage: "de", expectedLocation: "https://docs.example.com/de/"},
+		{name: "region_fallback", acceptLanguage: "de-AT,en;q=0.8", expectedLocation: "https://docs.example.com/de/"},
+		{name: "q_values", acceptLanguage: "de;q=0.5, pt;q=0.9", expectedLocation: "https://docs.example.com/pt/"},
+		{name: "no_match", acceptLanguage: "fr-FR, ja;q=0.5", expectedLocation: "https://docs.example.com/en/"},
+		{name: "no_header", expectedLocation: "https://docs.example.com/en/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/docs", nil)
+			if tt.acceptLanguage != "" {
+				request.Header.Set("Accept-Language", tt.acceptLanguage)
+			}
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", "docs")
+			request = request.WithContext(context.WithValue(request.Context(), chi.RouteCtxKey, rctx))
+
+			w := httptest.NewRecorder()
+			handlerGet(cfg, fileStorage, noBlocklist(t), nil, nil, nil)(w, request)
+
+			assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+			assert.Equal(t, tt.expectedLocation, w.Header().Get("Location"))
+			assert.Equal(t, "Accept-Language", w.Header().Get("Vary"))
+		})
+	}
+
+	t.Run("validation", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		body := strings.NewReader(`{"url": "https://docs.example.com/", "targeting": {"language": [{"languages": ["de", "en_US"], "url": "https://docs.example.com/de/"}, {"languages": ["DE"], "url": "https://docs.example.com/x/"}]}}`)
+		PostShortenRequest(cfg, fileStorage, noBlocklist(t), nil)(w, httptest.NewRequest(http.MethodPost, "/api/shorten", body))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), `invalid language tag "en_US"`)
+		assert.Contains(t, w.Body.String(), "already used in rule 0")
+	})
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/ivanlp-p/ShortLinkService/cmd/config"
+	"github.com/ivanlp-p/ShortLinkService/internal/blocklist"
+	"github.com/ivanlp-p/ShortLinkService/internal/limits"
+	"github.com/ivanlp-p/ShortLinkService/internal/models"
+	"github.com/ivanlp-p/ShortLinkService/internal/normalize"
+	"github.com/ivanlp-p/ShortLinkService/internal/selfref"
+	"github.com/ivanlp-p/ShortLinkService/internal/storage"
+	"github.com/ivanlp-p/ShortLinkService/internal/utils"
+	"net/http"
+	"strconv"
+)
+
+// urlChecker проверяет адреса назначения перед сокращением.
+type urlChecker struct {
+	cfg       *config.Config
+	norm      *normalize.Normalizer
+	blocklist *blocklist.Blocklist
+	guard     *selfref.Guard
+}
+
+func newURLChecker(cfg *config.Config, bl *blocklist.Blocklist, fileStorage *storage.FileStorage) *urlChecker {
+	lookup := func(ctx context.Context, id string) (string, error) {
+		link, err := fileStorage.GetShortLink(ctx, id)
+		if errors.Is(err, storage.ErrNotFound) {
+			return "", selfref.ErrNotFound
+		}
+		if err != nil {
+			return "", err
+		}
+		// Иначе склейка цепочки раскрыла бы адрес назначения без пароля
+		if link.PasswordHash != "" {
+			return "", &selfref.Error{Reason: "destination points to password-protected short link " + strconv.Quote(id)}
+		}
+		return link.OriginalURL, nil
+	}
+	// Config.Validate гарантирует, что BaseURL корректен
+	guard, _ := selfref.New(cfg.BaseURL, cfg.OwnDomains, cfg.FlattenChains, lookup)
+
+	return &urlChecker{
+		cfg: cfg,
+		norm: normalize.New(normalize.Options{
+			AllowedSchemes: cfg.AllowedSchemes,
+			StripFragment:  cfg.StripFragment,
+			SortQuery:      cfg.SortQuery,
+		}),
+		blocklist: bl,
+		guard:     guard,
+	}
+}
+
+// check проверяет URL перед сокращением и возвращает его каноническую форму.
+// Если URL не подходит, check сам отвечает клиенту и возвращает false.
+func (c *urlChecker) check(ctx context.Context, w http.ResponseWriter, raw string) (string, bool) {
+	if len(raw) > c.cfg.MaxURLLength {
+		limits.TooLarge(w, "URL", int64(c.cfg.MaxURLLength))
+		return "", false
+	}
+
+	normalized, err := c.norm.Normalize(raw)
+	if err != nil {
+		var nerr *normalize.Error
+		if errors.As(err, &nerr) {
+			http.Error(w, "Bad Request: "+nerr.Error(), http.StatusBadRequest)
+			return "", false
+		}
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return "", false
+	}
+
+	destination, err := c.guard.Resolve(ctx, utils.ShortenURL(normalized), normalized)
+	if err != nil {
+		var serr *selfref.Error
+		if errors.As(err, &serr) {
+			http.Error(w, "Bad Request: "+serr.Error(), http.StatusBadRequest)
+			return "", false
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return "", false
+	}
+
+	if rule, blocked := c.blocklist.Check(destination); blocked {
+		http.Error(w, http.StatusText(rule.Status)+": destination is blocked: "+rule.Reason, rule.Status)
+		return "", false
+	}
+	return destination, true
+}
+
+// checkTargeting проверяет и нормализует адреса в правилах t так же, как основной адрес.
+func (c *urlChecker) checkTargeting(ctx context.Context, w http.ResponseWriter, t *models.Targeting) bool {
+	if t == nil {
+		return true
+	}
+	for i := range t.Device {
+		normalized, ok := c.check(ctx, w, t.Device[i].URL)
+		if !ok {
+			return false
+		}
+		t.Device[i].URL = normalized
+	}
+	for i := range t.Country {
+		normalized, ok := c.check(ctx, w, t.Country[i].URL)
+		if !ok {
+			return false
+		}
+		t.Country[i].URL = normalized
+	}
+	for i := range t.Language {
+		normalized, ok := c.check(ctx, w, t.Language[i].URL)
+		if !ok {
+			return false
+		}
+		t.Language[i].URL = normalized
+	}
+	return true
+}
+
+// checkVariants проверяет и нормализует адреса вариантов A/B-теста.
+func (c *urlChecker) checkVariants(ctx context.Context, w http.ResponseWriter, variants []models.Variant) bool {
+	for i := range variants {
+		normalized, ok := c.check(ctx, w, variants[i].URL)
+		if !ok {
+			return false
+		}
+		variants[i].URL = normalized
+	}
+	return true
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ivanlp-p/ShortLinkService/internal/models"
+	"math/rand/v2"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+const (
+	variantCookiePrefix = "sl_variant_"
+	variantCookieMaxAge = 30 * 24 * time.Hour
+	maxVariantWeight    = 1_000_000
+)
+
+var variantNameRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// validateVariants проверяет имена и веса вариантов; адреса проверяет urlChecker.
+func validateVariants(variants []models.Variant) error {
+	var errs []error
+	names := make(map[string]bool, len(variants))
+	for i, v := range variants {
+		if !variantNameRe.MatchString(v.Name) {
+			errs = append(errs, fmt.Errorf("variant %d: name %q must be 1-32 letters, digits, '-' or '_'", i, v.Name))
+		} else if names[v.Name] {
+			errs = append(errs, fmt.Errorf("variant %d: duplicate name %q", i, v.Name))
+		}
+		names[v.Name] = true
+		if v.URL == "" {
+			errs = append(errs, fmt.Errorf("variant %d: url must not be empty", i))
+		}
+		if v.Weight <= 0 || v.Weight > maxVariantWeight {
+			errs = append(errs, fmt.Errorf("variant %d: weight %d must be between 1 and %d", i, v.Weight, maxVariantWeight))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func variantCookieName(link models.ShortLink) string {
+	return variantCookiePrefix + link.ShortURL
+}
+
+// chooseVariant выбирает вариант пропорционально весам. Для ссылок со
+// StickyVariant посетитель получает вариант из cookie, если тот ещё существует.
+func chooseVariant(r *http.Request, link models.ShortLink) (models.Variant, bool) {
+	if len(link.Variants) == 0 {
+		return models.Variant{}, false
+	}
+	if link.StickyVariant {
+		if c, err := r.Cookie(variantCookieName(link)); err == nil {
+			for _, v := range link.Variants {
+				if v.Name == c.Value {
+					return v, true
+				}
+			}
+		}
+	}
+
+	total := 0
+	for _, v := range link.Variants {
+		total += v.Weight
+	}
+	n := rand.IntN(total)
+	for _, v := range link.Variants {
+		if n < v.Weight {
+			return v, true
+		}
+		n -= v.Weight
+	}
+	return link.Variants[len(link.Variants)-1], true
+}
+
+// setVariantCookie запоминает показанный вариант, чтобы повторные переходы вели туда же.
+func setVariantCookie(w http.ResponseWriter, link models.ShortLink, variant string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     variantCookieName(link),
+		Value:    variant,
+		Path:     "/" + link.ShortURL,
+		MaxAge:   int(variantCookieMaxAge / time.Second),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/ivanlp-p/ShortLinkService/cmd/config"
+	"github.com/ivanlp-p/ShortLinkService/internal/models"
+	"github.com/ivanlp-p/ShortLinkService/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func getLink(t *testing.T, h http.HandlerFunc, id string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+	request := httptest.NewRequest(http.MethodGet, "/"+id, nil)
+	for _, c := range cookies {
+		request.AddCookie(c)
+	}
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", id)
+	request = request.WithContext(context.WithValue(request.Context(), chi.RouteCtxKey, rctx))
+
+	w := httptest.NewRecorder()
+	h(w, request)
+	return w
+}
+
+func Test_variants(t *testing.T) {
+	cfg := config.Default()
+	store := storage.NewMapStorage()
+	variants := []models.Variant{
+		{Name: "a", URL: "https://example.com/a", Weight: 80},
+		{Name: "b", URL: "https://example.com/b", Weight: 20},
+	}
+	store.Put(models.ShortLink{ShortURL: "split", OriginalURL: "https://example.com/", Variants: variants})
+	store.Put(models.ShortLink{ShortURL: "sticky", OriginalURL: "https://example.com/", Variants: variants, StickyVariant: true})
+	fileStorage := storage.NewFileStorage(filepath.Join(t.TempDir(), "db.json"), store)
+	h := handlerGet(cfg, fileStorage, noBlocklist(t), nil, nil, nil)
+
+	t.Run("weighted", func(t *testing.T) {
+		const n = 2000
+		served := make(map[string]int)
+		for i := 0; i < n; i++ {
+			w := getLink(t, h, "split")
+			require.Equal(t, http.StatusTemporaryRedirect, w.Code)
+			assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+			assert.Empty(t, w.Result().Cookies(), "non-sticky split must not set cookies")
+			served[w.Header().Get("Location")]++
+		}
+		assert.InDelta(t, 0.8, float64(served["https://example.com/a"])/n, 0.05)
+		assert.Equal(t, n, served["https://example.com/a"]+served["https://example.com/b"])
+
+		request := httptest.NewRequest(http.MethodGet, "/api/links/split/stats", nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", "split")
+		request = request.WithContext(context.WithValue(request.Context(), chi.RouteCtxKey, rctx))
+		w := httptest.NewRecorder()
+		handlerStats(fileStorage)(w, request)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		var stats models.LinkStats
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+		assert.Equal(t, int64(n), stats.Clicks)
+		assert.Equal(t, int64(served["https://example.com/a"]), stats.Variants["a"])
+		assert.Equal(t, int64(served["https://example.com/b"]), stats.Variants["b"])
+	})
+
+	t.Run("sticky", func(t *testing.T) {
+		w := getLink(t, h, "sticky")
+		require.Equal(t, http.StatusTemporaryRedirect, w.Code)
+		cookies := w.Result().Cookies()
+		require.Len(t, cookies, 1)
+		assert.Equal(t, "/sticky", cookies[0].Path)
+		assert.True(t, cookies[0].HttpOnly)
+		first := w.Header().Get("Location")
+
+		for i := 0; i < 50; i++ {
+			w := getLink(t, h, "sticky", cookies[0])
+			assert.Equal(t, first, w.Header().Get("Location"))
+		}
+
+		w = getLink(t, h, "sticky", &http.Cookie{Name: cookies[0].Name, Value: "removed"})
+		assert.Contains(t, []string{"https://example.com/a", "https://example.com/b"}, w.Header().Get("Location"))
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		body := strings.NewReader(`{"url": "https://example.com/", "variants": [{"name": "a", "url": "https://example.com/a", "weight": 0}, {"name": "a", "url": "https://example.com/b", "weight": 1}]}`)
+		PostShortenRequest(cfg, fileStorage, noBlocklist(t), nil)(w, httptest.NewRequest(http.MethodPost, "/api/shorten", body))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "weight 0")
+		assert.Contains(t, w.Body.String(), `duplicate name "a"`)
+	})
+}
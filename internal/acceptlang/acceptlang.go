@@ -0,0 +1,115 @@
+// Package acceptlang разбирает заголовок Accept-Language (RFC 9110, раздел 12.5.4)
+// и подбирает наиболее подходящий язык из доступных.
+package acceptlang
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var tagRe = regexp.MustCompile(`^[a-z]{1,8}(-[a-z0-9]{1,8})*$`)
+
+// ValidTag сообщает, является ли tag синтаксически корректным языковым тегом (BCP 47).
+func ValidTag(tag string) bool {
+	return tagRe.MatchString(strings.ToLower(tag))
+}
+
+// Range — язык из заголовка с его весом.
+type Range struct {
+	Tag string
+	Q   float64
+}
+
+// Parse разбирает заголовок и возвращает языки в порядке убывания веса.
+// Языки с одинаковым весом сохраняют порядок из заголовка. Некорректные
+// элементы пропускаются.
+func Parse(header string) []Range {
+	var ranges []Range
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "*" && !tagRe.MatchString(tag) {
+			continue
+		}
+		q := 1.0
+		if params = strings.TrimSpace(params); params != "" {
+			name, value, ok := strings.Cut(params, "=")
+			if !ok || strings.TrimSpace(name) != "q" {
+				continue
+			}
+			v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || v < 0 || v > 1 {
+				continue
+			}
+			q = v
+		}
+		ranges = append(ranges, Range{Tag: tag, Q: q})
+	}
+	slices.SortStableFunc(ranges, func(a, b Range) int {
+		switch {
+		case a.Q > b.Q:
+			return -1
+		case a.Q < b.Q:
+			return 1
+		}
+		return 0
+	})
+	return ranges
+}
+
+// Match возвращает индекс языка из available, лучше всего подходящего под
+// заголовок header. Для каждого языка из заголовка по убыванию веса ищется
+// точное совпадение, затем более общий доступный тег (de-AT → de), затем
+// более частный (de → de-CH). «*» выбирает первый доступный язык, не
+// исключённый весом 0. ok == false, если ничего не подошло.
+func Match(header string, available []string) (index int, ok bool) {
+	ranges := Parse(header)
+	tags := make([]string, len(available))
+	for i, tag := range available {
+		tags[i] = strings.ToLower(tag)
+	}
+
+	excluded := make(map[string]bool)
+	for _, r := range ranges {
+		if r.Q == 0 {
+			excluded[r.Tag] = true
+		}
+	}
+
+	for _, r := range ranges {
+		if r.Q == 0 {
+			break
+		}
+		if r.Tag == "*" {
+			for i, tag := range tags {
+				if !excluded[tag] {
+					return i, true
+				}
+			}
+			continue
+		}
+		// Точное совпадение, затем отсечение подтегов справа
+		for prefix := r.Tag; prefix != ""; prefix = parent(prefix) {
+			if i := slices.Index(tags, prefix); i >= 0 && !excluded[prefix] {
+				return i, true
+			}
+		}
+		for i, tag := range tags {
+			if strings.HasPrefix(tag, r.Tag+"-") && !excluded[tag] {
+				return i, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// parent отбрасывает последний подтег: de-ch-1996 → de-ch → de → "".
+func parent(tag string) string {
+	i := strings.LastIndexByte(tag, '-')
+	if i < 0 {
+		return ""
+	}
+	return tag[:i]
+}
@@ -0,0 +1,81 @@
+package acceptlang
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   []Range
+	}{
+		{name: "empty", header: ""},
+		{
+			name:   "q_order",
+			header: "en;q=0.5, de-DE, fr;q=0.9",
+			want:   []Range{{Tag: "de-de", Q: 1}, {Tag: "fr", Q: 0.9}, {Tag: "en", Q: 0.5}},
+		},
+		{
+			name:   "stable_ties",
+			header: "fr, en, *;q=0.1",
+			want:   []Range{{Tag: "fr", Q: 1}, {Tag: "en", Q: 1}, {Tag: "*", Q: 0.1}},
+		},
+		{
+			name:   "invalid_skipped",
+			header: "en;q=2, de;x=1, f_r, ru;q=0",
+			want:   []Range{{Tag: "ru", Q: 0}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Parse(tt.header))
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	available := []string{"en", "de", "pt-BR", "zh-Hant"}
+	tests := []struct {
+		name      string
+		header    string
+		available []string
+		want      int
+		wantOK    bool
+	}{
+		{name: "exact", header: "de", want: 1, wantOK: true},
+		{name: "case_insensitive", header: "PT-br", want: 2, wantOK: true},
+		{name: "q_preference", header: "en;q=0.4, de;q=0.8", want: 1, wantOK: true},
+		{name: "truncation", header: "de-AT", want: 1, wantOK: true},
+		{name: "more_specific_available", header: "pt", want: 2, wantOK: true},
+		{name: "first_acceptable", header: "ja, zh-Hant-TW;q=0.7, en;q=0.5", want: 3, wantOK: true},
+		{name: "wildcard", header: "ja, *;q=0.1", want: 0, wantOK: true},
+		{name: "wildcard_excluded", header: "*, en;q=0", want: 1, wantOK: true},
+		{name: "excluded_exact", header: "de-AT, de;q=0", wantOK: false},
+		{name: "no_match", header: "ja, ko"},
+		{name: "empty_header", header: ""},
+		{name: "no_available", header: "en", available: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			avail := available
+			if tt.available != nil {
+				avail = tt.available
+			}
+			got, ok := Match(tt.header, avail)
+			assert.Equal(t, tt.wantOK, ok)
+			if tt.wantOK {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestValidTag(t *testing.T) {
+	assert.True(t, ValidTag("en"))
+	assert.True(t, ValidTag("zh-Hant-TW"))
+	assert.False(t, ValidTag("*"))
+	assert.False(t, ValidTag("english_us"))
+	assert.False(t, ValidTag(""))
+}
@@ -0,0 +1,106 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"github.com/ivanlp-p/ShortLinkService/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := Open(path)
+	require.NoError(t, err)
+
+	now := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	l.Now = func() time.Time { return now }
+
+	record := func(e Entry) {
+		t.Helper()
+		require.NoError(t, l.Record(e))
+		now = now.Add(time.Hour)
+	}
+	record(Entry{Actor: "alice", Action: ActionCreate, LinkID: "a", After: &models.LinkInfo{Version: 1}, RequestID: "r1", ClientIP: "192.0.2.1"})
+	record(Entry{Actor: "alice", Action: ActionUpdate, LinkID: "a", Before: &models.LinkInfo{Version: 1}, After: &models.LinkInfo{Version: 2}})
+	record(Entry{Actor: "bob", Action: ActionCreate, LinkID: "b"})
+	record(Entry{Actor: "admin:10.0.0.1", Action: ActionTargeting, LinkID: "a"})
+
+	ids := func(entries []Entry) []int64 {
+		var ids []int64
+		for _, e := range entries {
+			ids = append(ids, e.ID)
+		}
+		return ids
+	}
+	start := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []int64
+	}{
+		{name: "all", want: []int64{1, 2, 3, 4}},
+		{name: "actor", filter: Filter{Actor: "alice"}, want: []int64{1, 2}},
+		{name: "action", filter: Filter{Action: ActionCreate}, want: []int64{1, 3}},
+		{name: "link", filter: Filter{LinkID: "a"}, want: []int64{1, 2, 4}},
+		{name: "since_until", filter: Filter{Since: start.Add(time.Hour), Until: start.Add(3 * time.Hour)}, want: []int64{2, 3}},
+		{name: "limit_keeps_latest", filter: Filter{LinkID: "a", Limit: 2}, want: []int64{2, 4}},
+		{name: "combined", filter: Filter{Actor: "alice", Action: ActionUpdate}, want: []int64{2}},
+		{name: "none", filter: Filter{Actor: "mallory"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ids(l.Query(tt.filter)))
+		})
+	}
+
+	t.Run("reopen", func(t *testing.T) {
+		reopened, err := Open(path)
+		require.NoError(t, err)
+		entries := reopened.Query(Filter{})
+		require.Len(t, entries, 4)
+		assert.Equal(t, "r1", entries[0].RequestID)
+		assert.Equal(t, "192.0.2.1", entries[0].ClientIP)
+		assert.Equal(t, 2, entries[1].After.Version)
+		assert.Equal(t, start, entries[0].Time)
+
+		require.NoError(t, reopened.Record(Entry{Actor: "carol", Action: ActionRollback, LinkID: "b"}))
+		assert.Equal(t, int64(5), reopened.Query(Filter{Actor: "carol"})[0].ID, "numbering continues")
+	})
+
+	t.Run("export", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, l.Export(&buf, Filter{LinkID: "a"}))
+		scanner := bufio.NewScanner(&buf)
+		var got []int64
+		for scanner.Scan() {
+			var e Entry
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+			got = append(got, e.ID)
+		}
+		assert.Equal(t, []int64{1, 2, 4}, got)
+	})
+}
+
+func TestNilLog(t *testing.T) {
+	var l *Log
+	assert.NoError(t, l.Record(Entry{Actor: "alice"}))
+	assert.Empty(t, l.Query(Filter{}))
+}
+
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Open(filepath.Join(dir, "missing.jsonl"))
+	require.NoError(t, err)
+	assert.Empty(t, l.Query(Filter{}))
+
+	corrupted := filepath.Join(dir, "corrupted.jsonl")
+	require.NoError(t, os.WriteFile(corrupted, []byte("{\"id\": 1}\nnot json\n"), 0600))
+	_, err = Open(corrupted)
+	assert.ErrorContains(t, err, "line 2")
+}
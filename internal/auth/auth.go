@@ -0,0 +1,89 @@
+// Package auth выдаёт посетителям API анонимный идентификатор пользователя
+// в подписанной cookie. По нему определяется владелец ссылок.
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"github.com/google/uuid"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CookieName — имя cookie с идентификатором пользователя.
+const CookieName = "user_id"
+
+const cookieMaxAge = 365 * 24 * time.Hour
+
+type ctxKey struct{}
+
+// Authenticator проверяет и выдаёт cookie с идентификатором пользователя.
+type Authenticator struct {
+	key []byte
+	// Secure — выдавать cookie только для HTTPS.
+	Secure bool
+}
+
+// New возвращает Authenticator, подписывающий cookie ключом key.
+func New(key []byte) *Authenticator {
+	return &Authenticator{key: key}
+}
+
+// Handler определяет пользователя по cookie и кладёт его идентификатор в
+// контекст запроса. Если cookie нет или подпись неверна, пользователю
+// выдаётся новый идентификатор.
+func (a *Authenticator) Handler(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := a.userID(r)
+		if !ok {
+			userID = uuid.NewString()
+			http.SetCookie(w, &http.Cookie{
+				Name:     CookieName,
+				Value:    a.sign(userID),
+				Path:     "/",
+				MaxAge:   int(cookieMaxAge / time.Second),
+				Secure:   a.Secure,
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+		h(w, r.WithContext(WithUserID(r.Context(), userID)))
+	}
+}
+
+func (a *Authenticator) userID(r *http.Request) (string, bool) {
+	c, err := r.Cookie(CookieName)
+	if err != nil {
+		return "", false
+	}
+	id, _, ok := strings.Cut(c.Value, ".")
+	if !ok || id == "" {
+		return "", false
+	}
+	return id, hmac.Equal([]byte(c.Value), []byte(a.sign(id)))
+}
+
+// Cookie возвращает cookie пользователя userID; нужна клиентам и тестам.
+func (a *Authenticator) Cookie(userID string) *http.Cookie {
+	return &http.Cookie{Name: CookieName, Value: a.sign(userID)}
+}
+
+func (a *Authenticator) sign(userID string) string {
+	m := hmac.New(sha256.New, a.key)
+	m.Write([]byte(userID))
+	return userID + "." + base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
+
+// WithUserID возвращает контекст с идентификатором пользователя.
+func WithUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, userID)
+}
+
+// UserID возвращает идентификатор пользователя из контекста запроса.
+func UserID(ctx context.Context) (string, bool) {
+	userID, ok := ctx.Value(ctxKey{}).(string)
+	return userID, ok && userID != ""
+}
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	a := New([]byte("key"))
+	var seen string
+	h := a.Handler(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = UserID(r.Context())
+	})
+
+	tests := []struct {
+		name      string
+		cookie    *http.Cookie
+		wantUser  string
+		wantIssue bool
+	}{
+		{name: "no_cookie", wantIssue: true},
+		{name: "valid", cookie: a.Cookie("alice"), wantUser: "alice"},
+		{name: "forged", cookie: &http.Cookie{Name: CookieName, Value: "alice.AAAA"}, wantIssue: true},
+		{name: "other_key", cookie: New([]byte("other")).Cookie("alice"), wantIssue: true},
+		{name: "unsigned", cookie: &http.Cookie{Name: CookieName, Value: "alice"}, wantIssue: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen = ""
+			request := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+			if tt.cookie != nil {
+				request.AddCookie(tt.cookie)
+			}
+			w := httptest.NewRecorder()
+			h(w, request)
+
+			cookies := w.Result().Cookies()
+			if !tt.wantIssue {
+				assert.Equal(t, tt.wantUser, seen)
+				assert.Empty(t, cookies)
+				return
+			}
+			require.Len(t, cookies, 1)
+			assert.NotEmpty(t, seen)
+			assert.NotEqual(t, "alice", seen)
+			assert.Equal(t, a.Cookie(seen).Value, cookies[0].Value)
+			assert.True(t, cookies[0].HttpOnly)
+		})
+	}
+}
@@ -0,0 +1,355 @@
+// Package blocklist проверяет адреса назначения по списку запрещённых доменов,
+// адресов и шаблонов.
+//
+// Формат файла — одно правило в строке:
+//
+//	# комментарий
+//	evil.example               домен целиком
+//	*.evil.example             все поддомены, но не сам evil.example
+//	re:^https?://[^/]+/login   регулярное выражение по всему URL
+//	203.0.113.7                IP-адрес
+//	198.51.100.0/24            диапазон адресов
+//	private                    все частные, loopback и link-local адреса
+//
+// Домены можно писать в Unicode: они сравниваются в punycode. IPv4-адреса
+// распознаются и в записях, которые понимают браузеры: 2130706433, 0x7f.1,
+// 0177.0.0.1, 127.1.
+//
+// После шаблона можно указать код ответа (403 или 451) и причину:
+//
+//	*.phish.example 451 Blocked by court order
+package blocklist
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"golang.org/x/net/idna"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// privateKeyword включает блокировку всех немаршрутизируемых IP-адресов.
+const privateKeyword = "private"
+
+const defaultReason = "Destination is blocked"
+
+// Rule — сработавшее правило.
+type Rule struct {
+	Pattern string
+	Status  int
+	Reason  string
+}
+
+type ipRule struct {
+	net  *net.IPNet
+	rule Rule
+}
+
+type regexRule struct {
+	re   *regexp.Regexp
+	rule Rule
+}
+
+// rules — неизменяемый разобранный список; при перезагрузке подменяется целиком.
+type rules struct {
+	exact    map[string]Rule
+	wildcard map[string]Rule
+	ips      []ipRule
+	regexps  []regexRule
+	private  *Rule
+}
+
+// parse разбирает список правил. Ошибки в строках собираются вместе с номерами строк.
+func parse(r io.Reader) (*rules, error) {
+	rs := &rules{
+		exact:    make(map[string]Rule),
+		wildcard: make(map[string]Rule),
+	}
+
+	var errs []string
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := rs.add(line); err != nil {
+			errs = append(errs, fmt.Sprintf("line %d: %v", lineNo, err))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("blocklist: %s", strings.Join(errs, "; "))
+	}
+	return rs, nil
+}
+
+func (rs *rules) add(line string) error {
+	fields := strings.Fields(line)
+	rule := Rule{Pattern: fields[0], Status: http.StatusForbidden, Reason: defaultReason}
+	rest := fields[1:]
+	if len(rest) > 0 {
+		if status, err := strconv.Atoi(rest[0]); err == nil {
+			if status != http.StatusForbidden && status != http.StatusUnavailableForLegalReasons {
+				return fmt.Errorf("status %d: must be 403 or 451", status)
+			}
+			rule.Status = status
+			rest = rest[1:]
+		}
+	}
+	if len(rest) > 0 {
+		rule.Reason = strings.Join(rest, " ")
+	}
+
+	pattern := rule.Pattern
+	switch {
+	case pattern == privateKeyword:
+		rs.private = &rule
+	case strings.HasPrefix(pattern, "re:"):
+		re, err := regexp.Compile(strings.TrimPrefix(pattern, "re:"))
+		if err != nil {
+			return err
+		}
+		rs.regexps = append(rs.regexps, regexRule{re: re, rule: rule})
+	case strings.Contains(pattern, "/"):
+		_, ipNet, err := net.ParseCIDR(pattern)
+		if err != nil {
+			return err
+		}
+		rs.ips = append(rs.ips, ipRule{net: ipNet, rule: rule})
+	case net.ParseIP(pattern) != nil:
+		ip := net.ParseIP(pattern)
+		bits := 8 * len(ip.To16())
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 32
+		}
+		rs.ips = append(rs.ips, ipRule{net: &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, rule: rule})
+	case strings.HasPrefix(pattern, "*."):
+		domain, err := idna.Lookup.ToASCII(strings.TrimPrefix(pattern, "*."))
+		if err != nil {
+			return fmt.Errorf("domain %q: %v", pattern, err)
+		}
+		rs.wildcard[domain] = rule
+	default:
+		domain, err := idna.Lookup.ToASCII(strings.TrimSuffix(pattern, "."))
+		if err != nil {
+			return fmt.Errorf("domain %q: %v", pattern, err)
+		}
+		rs.exact[domain] = rule
+	}
+	return nil
+}
+
+func (rs *rules) match(u *url.URL, raw string) (Rule, bool) {
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if ascii, err := idna.Lookup.ToASCII(host); err == nil {
+		host = ascii
+	}
+
+	if ip := hostIP(host); ip != nil {
+		for _, r := range rs.ips {
+			if r.net.Contains(ip) {
+				return r.rule, true
+			}
+		}
+		if rs.private != nil && isPrivate(ip) {
+			return *rs.private, true
+		}
+	} else {
+		if r, ok := rs.exact[host]; ok {
+			return r, true
+		}
+		// Проверяем все родительские домены: a.b.evil.example -> b.evil.example -> evil.example
+		for h := host; ; {
+			_, parent, ok := strings.Cut(h, ".")
+			if !ok {
+				break
+			}
+			if r, ok := rs.wildcard[parent]; ok {
+				return r, true
+			}
+			h = parent
+		}
+	}
+
+	for _, r := range rs.regexps {
+		if r.re.MatchString(raw) {
+			return r.rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+// hostIP возвращает адрес, если host — IP-адрес. IPv4 разбирается по
+// правилам WHATWG URL, как в браузерах и HTTP-клиентах: части могут быть
+// десятичными, восьмеричными (0177) и шестнадцатеричными (0x7f), а последняя
+// часть занимает все оставшиеся байты (127.1, 2130706433).
+func hostIP(host string) net.IP {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip
+	}
+	parts := strings.Split(host, ".")
+	if len(parts) > 4 {
+		return nil
+	}
+	numbers := make([]uint64, 0, len(parts))
+	for _, part := range parts {
+		n, ok := parseIPv4Number(part)
+		if !ok {
+			return nil
+		}
+		numbers = append(numbers, n)
+	}
+	last := len(numbers) - 1
+	if numbers[last] >= 1<<(8*(4-last)) {
+		return nil
+	}
+	ipv4 := numbers[last]
+	for i, n := range numbers[:last] {
+		if n > 255 {
+			return nil
+		}
+		ipv4 += n << (8 * (3 - i))
+	}
+	return net.IPv4(byte(ipv4>>24), byte(ipv4>>16), byte(ipv4>>8), byte(ipv4))
+}
+
+// parseIPv4Number разбирает одну часть IPv4-адреса: 0x — шестнадцатеричная,
+// ведущий 0 — восьмеричная, иначе десятичная.
+func parseIPv4Number(s string) (uint64, bool) {
+	base := 10
+	switch {
+	case strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X"):
+		s, base = s[2:], 16
+		if s == "" {
+			return 0, true
+		}
+	case len(s) > 1 && s[0] == '0':
+		s, base = s[1:], 8
+	}
+	if s == "" || strings.ContainsAny(s, "+-_") {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(s, base, 64)
+	return n, err == nil
+}
+
+func isPrivate(ip net.IP) bool {
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsUnspecified()
+}
+
+// Blocklist — список правил, загруженный из файла и перечитываемый при его изменении.
+type Blocklist struct {
+	rules atomic.Pointer[rules]
+
+	mu      sync.Mutex
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+// New загружает правила из path. Пустой path означает пустой список.
+func New(path string) (*Blocklist, error) {
+	b := &Blocklist{}
+	if err := b.Reload(path); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Reload перечитывает правила из path. При ошибке действуют прежние правила.
+func (b *Blocklist) Reload(path string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.load(path)
+}
+
+func (b *Blocklist) load(path string) error {
+	if path == "" {
+		empty, _ := parse(strings.NewReader(""))
+		b.rules.Store(empty)
+		b.path, b.modTime, b.size = "", time.Time{}, 0
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("blocklist: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("blocklist: %w", err)
+	}
+	rs, err := parse(file)
+	if err != nil {
+		return err
+	}
+
+	b.rules.Store(rs)
+	b.path, b.modTime, b.size = path, info.ModTime(), info.Size()
+	return nil
+}
+
+// changed сообщает, что файл изменился с момента последней загрузки.
+func (b *Blocklist) changed() bool {
+	if b.path == "" {
+		return false
+	}
+	info, err := os.Stat(b.path)
+	if err != nil {
+		return false
+	}
+	return !info.ModTime().Equal(b.modTime) || info.Size() != b.size
+}
+
+// Watch опрашивает файл раз в interval и перечитывает его при изменении,
+// пока не будет отменён ctx.
+func (b *Blocklist) Watch(ctx context.Context, interval time.Duration, log *zap.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			b.mu.Lock()
+			if b.changed() {
+				if err := b.load(b.path); err != nil {
+					log.Error("Blocklist reload failed, keeping previous rules", zap.Error(err))
+				} else {
+					log.Info("Blocklist reloaded", zap.String("path", b.path))
+				}
+			}
+			b.mu.Unlock()
+		}
+	}
+}
+
+// Check возвращает правило, запрещающее rawURL, если такое есть.
+func (b *Blocklist) Check(rawURL string) (Rule, bool) {
+	rs := b.rules.Load()
+	if rs == nil {
+		return Rule{}, false
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Rule{}, false
+	}
+	return rs.match(u, rawURL)
+}
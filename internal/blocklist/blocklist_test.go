@@ -0,0 +1,117 @@
+package blocklist
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testRules = `
+# фишинг
+evil.example
+*.phish.example 451 Blocked by court order
+re:^https?://[^/]+/wp-login\.php
+203.0.113.7
+198.51.100.0/24 403 Abusive network
+private
+`
+
+func writeRules(t *testing.T, path, rules string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(rules), 0644))
+}
+
+func TestBlocklist_Check(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	writeRules(t, path, testRules)
+	bl, err := New(path)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		url     string
+		blocked bool
+		status  int
+		reason  string
+	}{
+		{name: "exact", url: "https://evil.example/x", blocked: true, status: 403, reason: defaultReason},
+		{name: "exact_case_insensitive", url: "https://EVIL.example./x", blocked: true, status: 403},
+		{name: "exact_does_not_cover_subdomain", url: "https://www.evil.example/"},
+		{name: "wildcard_subdomain", url: "https://login.phish.example/", blocked: true, status: 451, reason: "Blocked by court order"},
+		{name: "wildcard_deep_subdomain", url: "https://a.b.phish.example/", blocked: true, status: 451},
+		{name: "wildcard_does_not_cover_apex", url: "https://phish.example/"},
+		{name: "regex", url: "http://blog.example.org/wp-login.php", blocked: true, status: 403},
+		{name: "ip_literal", url: "http://203.0.113.7:8080/", blocked: true, status: 403},
+		{name: "cidr", url: "http://198.51.100.20/", blocked: true, status: 403, reason: "Abusive network"},
+		{name: "private_range", url: "http://10.1.2.3/admin", blocked: true, status: 403},
+		{name: "loopback", url: "http://127.0.0.1/", blocked: true, status: 403},
+		{name: "ipv6_loopback", url: "http://[::1]/", blocked: true, status: 403},
+		{name: "public_ip", url: "http://8.8.8.8/"},
+		{name: "allowed", url: "https://practicum.yandex.ru"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, blocked := bl.Check(tt.url)
+			assert.Equal(t, tt.blocked, blocked)
+			if tt.blocked {
+				assert.Equal(t, tt.status, rule.Status)
+				if tt.reason != "" {
+					assert.Equal(t, tt.reason, rule.Reason)
+				}
+			}
+		})
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	_, err := parse(strings.NewReader("ok.example\nre:([\n10.0.0.0/99\nbad.example 500\n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "line 2")
+	assert.Contains(t, err.Error(), "line 3")
+	assert.Contains(t, err.Error(), "line 4")
+}
+
+func TestBlocklist_Watch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	writeRules(t, path, "evil.example\n")
+	bl, err := New(path)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go bl.Watch(ctx, 10*time.Millisecond, zap.NewNop())
+
+	_, blocked := bl.Check("https://new-evil.example/")
+	require.False(t, blocked)
+
+	writeRules(t, path, "evil.example\nnew-evil.example\n")
+	assert.Eventually(t, func() bool {
+		_, blocked := bl.Check("https://new-evil.example/")
+		return blocked
+	}, time.Second, 10*time.Millisecond)
+
+	// Ошибка в новом файле не сбрасывает действующие правила
+	writeRules(t, path, "re:([\n")
+	time.Sleep(50 * time.Millisecond)
+	_, blocked = bl.Check("https://new-evil.example/")
+	assert.True(t, blocked)
+}
+
+func TestWritePage(t *testing.T) {
+	w := httptest.NewRecorder()
+	WritePage(w, Rule{Status: http.StatusUnavailableForLegalReasons, Reason: "<script>alert(1)</script>"})
+
+	assert.Equal(t, http.StatusUnavailableForLegalReasons, w.Code)
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "Unavailable For Legal Reasons")
+	assert.Contains(t, w.Body.String(), "&lt;script&gt;")
+	assert.NotContains(t, w.Body.String(), "<script>")
+}
@@ -0,0 +1,34 @@
+package blocklist
+
+import (
+	"html/template"
+	"net/http"
+)
+
+var pageTemplate = template.Must(template.New("blocked").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>This short link leads to a destination that is not allowed.</p>
+<p>Reason: {{.Reason}}</p>
+</body>
+</html>
+`))
+
+// WritePage отвечает HTML-страницей о заблокированном адресе с кодом из правила.
+func WritePage(w http.ResponseWriter, rule Rule) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(rule.Status)
+	pageTemplate.Execute(w, struct {
+		Title  string
+		Reason string
+	}{
+		Title:  http.StatusText(rule.Status),
+		Reason: rule.Reason,
+	})
+}
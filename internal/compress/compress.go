@@ -1,51 +1,126 @@
 package compress
 
 import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/ivanlp-p/ShortLinkService/internal/limits"
+	"github.com/ivanlp-p/ShortLinkService/internal/tracing"
 	"net/http"
 	"strings"
 )
 
 const (
-	jsonType = "application/json"
-	htmlType = "text/html"
+	// DefaultMinSize — ответы короче этого размера не сжимаются:
+	// накладные расходы формата съедают весь выигрыш.
+	DefaultMinSize = 256
+	// DefaultLevel — уровень сжатия по умолчанию для всех кодировок.
+	DefaultLevel = gzip.DefaultCompression
+	// DefaultMaxDecodedSize ограничивает размер распакованного тела запроса,
+	// чтобы маленький «zip-бомба» не раздулся в гигабайты.
+	DefaultMaxDecodedSize = 10 << 20
 )
 
-func GzipCompress(h http.HandlerFunc) http.HandlerFunc {
+var errUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// Options задаёт настройки Compressor.
+type Options struct {
+	// Level задаётся по шкале gzip: 1–9 или -1 для значения по умолчанию.
+	Level int
+	// MinSize — минимальный размер ответа, который будет сжат.
+	MinSize int
+	// MaxDecodedSize — максимальный размер тела запроса после распаковки.
+	MaxDecodedSize int64
+}
+
+// DefaultOptions возвращает настройки сжатия по умолчанию.
+func DefaultOptions() Options {
+	return Options{
+		Level:          DefaultLevel,
+		MinSize:        DefaultMinSize,
+		MaxDecodedSize: DefaultMaxDecodedSize,
+	}
+}
+
+// Compressor хранит настройки сжатия и пулы кодировщиков.
+type Compressor struct {
+	minSize        int
+	maxDecodedSize int64
+	pools          *pools
+}
+
+// New создаёт Compressor с настройками opts.
+func New(opts Options) (*Compressor, error) {
+	var errs []error
+	if opts.Level != gzip.DefaultCompression && (opts.Level < gzip.BestSpeed || opts.Level > gzip.BestCompression) {
+		errs = append(errs, fmt.Errorf("compression level %d: must be -1 or between 1 and 9", opts.Level))
+	}
+	if opts.MinSize < 0 {
+		errs = append(errs, fmt.Errorf("compression min size %d: must not be negative", opts.MinSize))
+	}
+	if opts.MaxDecodedSize <= 0 {
+		errs = append(errs, fmt.Errorf("max decoded size %d: must be positive", opts.MaxDecodedSize))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return &Compressor{
+		minSize:        opts.MinSize,
+		maxDecodedSize: opts.MaxDecodedSize,
+		pools:          newPools(opts.Level, opts.MaxDecodedSize),
+	}, nil
+}
+
+var defaultCompressor, _ = New(DefaultOptions())
+
+// Compress оборачивает h с настройками сжатия по умолчанию.
+func Compress(h http.HandlerFunc) http.HandlerFunc {
+	return defaultCompressor.Handler(h)
+}
+
+// Handler распаковывает тело запроса по Content-Encoding и сжимает ответ
+// кодировкой, выбранной по Accept-Encoding. Сжимать ли ответ, решается по его
+// Content-Type, статусу и размеру.
+func (c *Compressor) Handler(h http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		ow := w
+		ctx, span := tracing.Start(r.Context(), "compress")
+		defer span.End()
+		r = r.WithContext(ctx)
+
+		// Ответ зависит от Accept-Encoding, даже если в итоге не сжат
+		w.Header().Add("Vary", "Accept-Encoding")
 
-		acceptEncoding := r.Header.Get("Accept-Encoding")
-		supportGzip := strings.Contains(acceptEncoding, "gzip")
-		if supportGzip && checkContentType(r) {
-			cw := newCompressWriter(w)
+		ow := w
+		if encoding := negotiateEncoding(r.Header.Get("Accept-Encoding")); encoding != "" {
+			span.SetAttribute("compress.response", encoding)
+			cw := newCompressWriter(w, encoding, c.minSize, c.pools)
 			ow = cw
 			defer cw.Close()
 		}
 
-		contentEncoding := r.Header.Get("Content-Encoding")
-		sendGzip := strings.Contains(contentEncoding, "gzip")
-		if sendGzip {
-			cr, err := newCompressReader(r.Body)
+		contentEncoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+		if contentEncoding != "" && contentEncoding != encodingIdentity {
+			span.SetAttribute("compress.request", contentEncoding)
+			cr, err := newCompressReader(contentEncoding, r.Body, c.pools)
+			if errors.Is(err, errUnsupportedEncoding) {
+				http.Error(w, "Unsupported Content-Encoding", http.StatusUnsupportedMediaType)
+				return
+			}
+			if limit, ok := limits.IsTooLarge(err); ok {
+				limits.TooLarge(w, "request body", limit)
+				return
+			}
 			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
+				span.RecordError(err)
+				http.Error(w, "Bad Request", http.StatusBadRequest)
 				return
 			}
-			r.Body = cr
+			r.Body = http.MaxBytesReader(w, cr, c.maxDecodedSize)
+			r.Header.Del("Content-Encoding")
+			r.ContentLength = -1
 			defer cr.Close()
 		}
 
 		h.ServeHTTP(ow, r)
 	}
 }
-
-func checkContentType(r *http.Request) bool {
-	contentTypeValues := r.Header.Values("Content-Type")
-	hasSupportType := false
-	for _, value := range contentTypeValues {
-		if strings.Contains(value, jsonType) || strings.Contains(value, htmlType) {
-			hasSupportType = true
-		}
-	}
-
-	return hasSupportType
-}
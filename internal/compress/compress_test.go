@@ -0,0 +1,413 @@
+package compress
+
+import (
+	"bytes"
+	"github.com/ivanlp-p/ShortLinkService/internal/limits"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{name: "empty", header: "", want: ""},
+		{name: "gzip_only", header: "gzip", want: encodingGzip},
+		{name: "server_preference_on_tie", header: "gzip, deflate, br, zstd", want: encodingZstd},
+		{name: "q_values", header: "gzip;q=0.5, deflate;q=0.8", want: encodingDeflate},
+		{name: "q_zero_rejects", header: "zstd;q=0, gzip", want: encodingGzip},
+		{name: "wildcard", header: "*", want: encodingZstd},
+		{name: "wildcard_with_exclusion", header: "*;q=0.1, zstd;q=0", want: encodingGzip},
+		{name: "identity_preferred", header: "identity, gzip;q=0.5", want: ""},
+		{name: "unsupported_only", header: "br", want: ""},
+		{name: "invalid_q", header: "gzip;q=2", want: ""},
+		{name: "case_insensitive", header: "GZIP;Q=1", want: encodingGzip},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, negotiateEncoding(tt.header))
+		})
+	}
+}
+
+func decode(t *testing.T, encoding string, body []byte) string {
+	t.Helper()
+	if encoding == "" {
+		return string(body)
+	}
+	r, err := newDecoder(encoding, bytes.NewReader(body), DefaultMaxDecodedSize)
+	require.NoError(t, err)
+	plain, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(plain)
+}
+
+func TestCompress_Response(t *testing.T) {
+	long := strings.Repeat(`{"result":"http://localhost:8080/abcdefgh"}`, 20)
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		status         int
+		body           string
+		wantEncoding   string
+	}{
+		{
+			name:           "gzip_json",
+			acceptEncoding: "gzip",
+			contentType:    "application/json",
+			status:         http.StatusOK,
+			body:           long,
+			wantEncoding:   encodingGzip,
+		},
+		{
+			name:           "deflate_json",
+			acceptEncoding: "deflate",
+			contentType:    "application/json",
+			status:         http.StatusCreated,
+			body:           long,
+			wantEncoding:   encodingDeflate,
+		},
+		{
+			name:           "zstd_text",
+			acceptEncoding: "zstd",
+			contentType:    "text/plain",
+			status:         http.StatusOK,
+			body:           long,
+			wantEncoding:   encodingZstd,
+		},
+		{
+			name:           "sniffed_content_type",
+			acceptEncoding: "gzip",
+			status:         http.StatusOK,
+			body:           "<html><body>" + long + "</body></html>",
+			wantEncoding:   encodingGzip,
+		},
+		{
+			name:           "below_threshold",
+			acceptEncoding: "gzip",
+			contentType:    "text/plain",
+			status:         http.StatusCreated,
+			body:           "http://localhost:8080/-8eOIgoJ",
+		},
+		{
+			name:           "not_compressible_type",
+			acceptEncoding: "gzip",
+			contentType:    "image/png",
+			status:         http.StatusOK,
+			body:           long,
+		},
+		{
+			name:           "error_status",
+			acceptEncoding: "gzip",
+			contentType:    "text/plain",
+			status:         http.StatusBadRequest,
+			body:           long,
+		},
+		{
+			name:        "no_accept_encoding",
+			contentType: "application/json",
+			status:      http.StatusOK,
+			body:        long,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := Compress(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				w.WriteHeader(tt.status)
+				// пишем частями, чтобы проверить буферизацию до порога
+				io.WriteString(w, tt.body[:len(tt.body)/2])
+				io.WriteString(w, tt.body[len(tt.body)/2:])
+			})
+
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.acceptEncoding != "" {
+				request.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			w := httptest.NewRecorder()
+			h(w, request)
+
+			result := w.Result()
+			defer result.Body.Close()
+			body, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.status, result.StatusCode)
+			assert.Equal(t, "Accept-Encoding", result.Header.Get("Vary"))
+			assert.Equal(t, tt.wantEncoding, result.Header.Get("Content-Encoding"))
+			assert.NotEmpty(t, result.Header.Get("Content-Type"))
+			assert.Equal(t, tt.body, decode(t, tt.wantEncoding, body))
+		})
+	}
+}
+
+func TestCompress_Redirect(t *testing.T) {
+	h := Compress(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", "https://example.com")
+		w.WriteHeader(http.StatusTemporaryRedirect)
+	})
+
+	request := httptest.NewRequest(http.MethodGet, "/abc", nil)
+	request.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h(w, request)
+
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "https://example.com", w.Header().Get("Location"))
+}
+
+func TestCompress_Request(t *testing.T) {
+	const payload = `{"url": "https://practicum.yandex.ru"}`
+
+	for _, encoding := range supportedEncodings {
+		t.Run(encoding, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc, err := newEncoder(encoding, DefaultLevel, &buf)
+			require.NoError(t, err)
+			_, err = enc.Write([]byte(payload))
+			require.NoError(t, err)
+			require.NoError(t, enc.Close())
+
+			var got string
+			h := Compress(func(w http.ResponseWriter, r *http.Request) {
+				body, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				got = string(body)
+			})
+
+			request := httptest.NewRequest(http.MethodPost, "/api/shorten", &buf)
+			request.Header.Set("Content-Encoding", encoding)
+			h(httptest.NewRecorder(), request)
+
+			assert.Equal(t, payload, got)
+		})
+	}
+
+	t.Run("unsupported", func(t *testing.T) {
+		h := Compress(func(w http.ResponseWriter, r *http.Request) {
+			t.Fatal("handler must not be called")
+		})
+		request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("x"))
+		request.Header.Set("Content-Encoding", "br")
+		w := httptest.NewRecorder()
+		h(w, request)
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	})
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(Options{Level: 10, MinSize: -1})
+	assert.ErrorContains(t, err, "compression level")
+	assert.ErrorContains(t, err, "min size")
+	assert.ErrorContains(t, err, "max decoded size")
+	_, err = New(Options{Level: 1, MaxDecodedSize: 1})
+	assert.NoError(t, err)
+}
+
+func TestCompress_Flush(t *testing.T) {
+	for _, encoding := range supportedEncodings {
+		t.Run(encoding, func(t *testing.T) {
+			chunks := make(chan string)
+			flushed := make(chan struct{})
+
+			c, err := New(DefaultOptions())
+			require.NoError(t, err)
+			h := c.Handler(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				w.Header().Set("Content-Length", "1000")
+				for chunk := range chunks {
+					io.WriteString(w, chunk)
+					w.(http.Flusher).Flush()
+					flushed <- struct{}{}
+				}
+			})
+
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.Header.Set("Accept-Encoding", encoding)
+			w := httptest.NewRecorder()
+			done := make(chan struct{})
+			go func() {
+				h(w, request)
+				close(done)
+			}()
+
+			chunks <- "data: first\n\n"
+			<-flushed
+			// Первая порция короче порога, но Flush обязан отправить её клиенту
+			assert.True(t, w.Flushed)
+			assert.Equal(t, encoding, w.Header().Get("Content-Encoding"))
+			assert.Empty(t, w.Header().Get("Content-Length"))
+			assert.NotZero(t, w.Body.Len())
+
+			chunks <- "data: second\n\n"
+			<-flushed
+			close(chunks)
+			<-done
+
+			assert.Equal(t, "data: first\n\ndata: second\n\n", decode(t, encoding, w.Body.Bytes()))
+		})
+	}
+}
+
+func TestCompress_PoolReuse(t *testing.T) {
+	long := strings.Repeat("reuse me ", 100)
+	c, err := New(DefaultOptions())
+	require.NoError(t, err)
+	h := c.Handler(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write(body)
+	})
+
+	for _, encoding := range supportedEncodings {
+		for i := 0; i < 3; i++ {
+			var buf bytes.Buffer
+			enc, err := newEncoder(encoding, DefaultLevel, &buf)
+			require.NoError(t, err)
+			io.WriteString(enc, long)
+			require.NoError(t, enc.Close())
+
+			request := httptest.NewRequest(http.MethodPost, "/", &buf)
+			request.Header.Set("Content-Encoding", encoding)
+			request.Header.Set("Accept-Encoding", encoding)
+			w := httptest.NewRecorder()
+			h(w, request)
+
+			require.Equal(t, encoding, w.Header().Get("Content-Encoding"))
+			assert.Equal(t, long, decode(t, encoding, w.Body.Bytes()), "%s request #%d", encoding, i)
+		}
+	}
+}
+
+func benchmarkResponse(b *testing.B, h http.HandlerFunc, encoding string) {
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set("Accept-Encoding", encoding)
+		for pb.Next() {
+			h(httptest.NewRecorder(), request)
+		}
+	})
+}
+
+var benchBody = []byte(strings.Repeat(`{"short_url":"http://localhost:8080/abcdefgh","original_url":"https://practicum.yandex.ru"}`, 50))
+
+func benchHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(benchBody)
+}
+
+// unpooledHandler повторяет прежнее поведение: новый кодировщик на каждый запрос.
+func unpooledHandler(encoding string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", encoding)
+		enc, _ := newEncoder(encoding, DefaultLevel, w)
+		enc.Write(benchBody)
+		enc.Close()
+	}
+}
+
+func BenchmarkCompress(b *testing.B) {
+	c, err := New(DefaultOptions())
+	require.NoError(b, err)
+	pooled := c.Handler(benchHandler)
+
+	for _, encoding := range supportedEncodings {
+		b.Run(encoding+"/pooled", func(b *testing.B) {
+			benchmarkResponse(b, pooled, encoding)
+		})
+		b.Run(encoding+"/unpooled", func(b *testing.B) {
+			benchmarkResponse(b, unpooledHandler(encoding), encoding)
+		})
+	}
+}
+
+func TestCompress_DecompressionBomb(t *testing.T) {
+	// 1 MiB нулей сжимается в единицы килобайт
+	var buf bytes.Buffer
+	enc, err := newEncoder(encodingGzip, DefaultLevel, &buf)
+	require.NoError(t, err)
+	enc.Write(make([]byte, 1<<20))
+	require.NoError(t, enc.Close())
+
+	opts := DefaultOptions()
+	opts.MaxDecodedSize = 64 << 10
+	c, err := New(opts)
+	require.NoError(t, err)
+
+	h := c.Handler(func(w http.ResponseWriter, r *http.Request) {
+		_, err := io.ReadAll(r.Body)
+		limit, ok := limits.IsTooLarge(err)
+		require.True(t, ok)
+		limits.TooLarge(w, "decompressed body", limit)
+	})
+
+	request := httptest.NewRequest(http.MethodPost, "/", &buf)
+	request.Header.Set("Content-Encoding", encodingGzip)
+	w := httptest.NewRecorder()
+	h(w, request)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Contains(t, w.Body.String(), "exceeds 65536 bytes")
+}
+
+func TestCompress_ZstdWindow(t *testing.T) {
+	// zstdFrame — кадр из одного несжатого блока "hi" с окном 1 << windowLog
+	// и без размера содержимого в заголовке
+	zstdFrame := func(windowLog byte) []byte {
+		return []byte{
+			0x28, 0xb5, 0x2f, 0xfd, // магическое число
+			0x00,                  // дескриптор кадра: ни размера, ни контрольной суммы
+			(windowLog - 10) << 3, // дескриптор окна
+			0x11, 0x00, 0x00,      // последний блок, raw, 2 байта
+			'h', 'i',
+		}
+	}
+
+	c, err := New(DefaultOptions())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		windowLog byte
+		wantErr   error
+	}{
+		{name: "small_window", windowLog: 16},
+		{name: "window_within_limit", windowLog: 23},
+		{name: "hostile_window", windowLog: 28, wantErr: zstd.ErrWindowSizeExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body []byte
+			var readErr error
+			h := c.Handler(func(w http.ResponseWriter, r *http.Request) {
+				body, readErr = io.ReadAll(r.Body)
+			})
+
+			request := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(zstdFrame(tt.windowLog)))
+			request.Header.Set("Content-Encoding", encodingZstd)
+			h(httptest.NewRecorder(), request)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, readErr, tt.wantErr)
+				return
+			}
+			require.NoError(t, readErr)
+			assert.Equal(t, "hi", string(body))
+		})
+	}
+}
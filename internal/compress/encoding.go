@@ -0,0 +1,146 @@
+package compress
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Поддерживаемые значения Content-Encoding.
+const (
+	encodingZstd     = "zstd"
+	encodingGzip     = "gzip"
+	encodingDeflate  = "deflate"
+	encodingIdentity = "identity"
+)
+
+// supportedEncodings перечислены в порядке предпочтения сервера:
+// он используется, если клиент принимает несколько кодировок с одинаковым q.
+var supportedEncodings = []string{encodingZstd, encodingGzip, encodingDeflate}
+
+// newEncoder создаёт сжимающий writer для кодировки. level задаётся
+// по шкале gzip: от BestSpeed до BestCompression или DefaultCompression.
+func newEncoder(encoding string, level int, w io.Writer) (resetWriter, error) {
+	switch encoding {
+	case encodingZstd:
+		zlevel := zstd.SpeedDefault
+		if level != gzip.DefaultCompression {
+			zlevel = zstd.EncoderLevelFromZstd(level)
+		}
+		return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1), zstd.WithEncoderLevel(zlevel))
+	case encodingGzip:
+		return gzip.NewWriterLevel(w, level)
+	case encodingDeflate:
+		// В HTTP "deflate" означает поток в формате zlib (RFC 1950)
+		return zlib.NewWriterLevel(w, level)
+	}
+	return nil, errUnsupportedEncoding
+}
+
+// newDecoder создаёт распаковывающий reader для кодировки. maxDecodedSize
+// ограничивает и окно zstd: иначе крошечный кадр с заявленным окном в сотни
+// мегабайт заставил бы декодер выделить под него память ещё до MaxBytesReader.
+func newDecoder(encoding string, r io.Reader, maxDecodedSize int64) (resetReader, error) {
+	switch encoding {
+	case encodingZstd:
+		maxWindow := min(max(uint64(maxDecodedSize), zstd.MinWindowSize), zstd.MaxWindowSize)
+		return zstd.NewReader(r,
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderMaxMemory(uint64(maxDecodedSize)),
+			zstd.WithDecoderMaxWindow(maxWindow),
+		)
+	case encodingGzip:
+		return gzip.NewReader(r)
+	case encodingDeflate:
+		zr, err := zlib.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return zlibReader{zr}, nil
+	}
+	return nil, errUnsupportedEncoding
+}
+
+// negotiateEncoding выбирает кодировку ответа по заголовку Accept-Encoding
+// с учётом q-значений. Пустая строка означает, что ответ не сжимается.
+func negotiateEncoding(acceptEncoding string) string {
+	if strings.TrimSpace(acceptEncoding) == "" {
+		return ""
+	}
+
+	weights := make(map[string]float64)
+	wildcard := -1.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, q := parseEncodingQ(part)
+		if name == "" {
+			continue
+		}
+		if name == "*" {
+			wildcard = q
+			continue
+		}
+		weights[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, enc := range supportedEncodings {
+		q, ok := weights[enc]
+		if !ok {
+			if wildcard < 0 {
+				continue
+			}
+			q = wildcard
+		}
+		if q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+
+	// Клиент явно предпочитает несжатый ответ
+	if q, ok := weights[encodingIdentity]; ok && q > bestQ {
+		return ""
+	}
+	return best
+}
+
+func parseEncodingQ(part string) (string, float64) {
+	params := strings.Split(part, ";")
+	name := strings.ToLower(strings.TrimSpace(params[0]))
+	q := 1.0
+	for _, p := range params[1:] {
+		key, value, ok := strings.Cut(strings.TrimSpace(p), "=")
+		if !ok || strings.ToLower(strings.TrimSpace(key)) != "q" {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || parsed < 0 || parsed > 1 {
+			return "", 0
+		}
+		q = parsed
+	}
+	return name, q
+}
+
+// compressibleTypes — типы содержимого, которые имеет смысл сжимать.
+var compressibleTypes = []string{
+	"text/",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"application/xhtml+xml",
+	"image/svg+xml",
+}
+
+func isCompressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	for _, t := range compressibleTypes {
+		if strings.HasPrefix(mediaType, t) {
+			return true
+		}
+	}
+	return strings.HasSuffix(mediaType, "+json")
+}
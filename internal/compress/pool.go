@@ -0,0 +1,97 @@
+package compress
+
+import (
+	"compress/zlib"
+	"io"
+	"sync"
+)
+
+// resetWriter — кодировщик, который можно переиспользовать для нового потока.
+// Ему соответствуют gzip.Writer, zlib.Writer и zstd.Encoder.
+type resetWriter interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// resetReader — декодер, который можно переиспользовать для нового потока.
+type resetReader interface {
+	io.Reader
+	Reset(r io.Reader) error
+}
+
+// zlibReader приводит zlib.Resetter к интерфейсу resetReader.
+type zlibReader struct {
+	io.ReadCloser
+}
+
+func (z zlibReader) Reset(r io.Reader) error {
+	return z.ReadCloser.(zlib.Resetter).Reset(r, nil)
+}
+
+// pools хранит по одному sync.Pool кодировщиков и декодеров на каждую кодировку.
+// Создание gzip.Writer и особенно zstd.Encoder стоит сотни килобайт аллокаций,
+// поэтому объекты переиспользуются между запросами.
+type pools struct {
+	writers        map[string]*sync.Pool
+	readers        map[string]*sync.Pool
+	maxDecodedSize int64
+}
+
+func newPools(level int, maxDecodedSize int64) *pools {
+	p := &pools{
+		writers:        make(map[string]*sync.Pool, len(supportedEncodings)),
+		readers:        make(map[string]*sync.Pool, len(supportedEncodings)),
+		maxDecodedSize: maxDecodedSize,
+	}
+	for _, enc := range supportedEncodings {
+		enc := enc
+		p.writers[enc] = &sync.Pool{
+			New: func() any {
+				// Уровень проверяется в New, поэтому ошибки здесь быть не может
+				w, _ := newEncoder(enc, level, io.Discard)
+				return w
+			},
+		}
+		// Декодеры gzip и zlib читают заголовок при создании,
+		// поэтому New не задан: новый декодер создаётся по месту в getReader
+		p.readers[enc] = &sync.Pool{}
+	}
+	return p
+}
+
+func (p *pools) getWriter(encoding string, w io.Writer) (resetWriter, error) {
+	pool, ok := p.writers[encoding]
+	if !ok {
+		return nil, errUnsupportedEncoding
+	}
+	enc := pool.Get().(resetWriter)
+	enc.Reset(w)
+	return enc, nil
+}
+
+func (p *pools) putWriter(encoding string, enc resetWriter) {
+	// Не держим ссылку на ResponseWriter завершённого запроса
+	enc.Reset(io.Discard)
+	p.writers[encoding].Put(enc)
+}
+
+func (p *pools) getReader(encoding string, r io.Reader) (resetReader, error) {
+	pool, ok := p.readers[encoding]
+	if !ok {
+		return nil, errUnsupportedEncoding
+	}
+	if v := pool.Get(); v != nil {
+		dec := v.(resetReader)
+		if err := dec.Reset(r); err != nil {
+			pool.Put(dec)
+			return nil, err
+		}
+		return dec, nil
+	}
+	return newDecoder(encoding, r, p.maxDecodedSize)
+}
+
+func (p *pools) putReader(encoding string, dec resetReader) {
+	p.readers[encoding].Put(dec)
+}
@@ -0,0 +1,45 @@
+package compress
+
+import (
+	"io"
+)
+
+// compressReader реализует интерфейс io.ReadCloser и позволяет прозрачно для сервера
+// декомпрессировать получаемые от клиента данные
+type compressReader struct {
+	r        io.ReadCloser
+	zr       resetReader
+	encoding string
+	pools    *pools
+}
+
+func newCompressReader(encoding string, r io.ReadCloser, p *pools) (*compressReader, error) {
+	zr, err := p.getReader(encoding, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &compressReader{
+		r:        r,
+		zr:       zr,
+		encoding: encoding,
+		pools:    p,
+	}, nil
+}
+
+func (c *compressReader) Read(p []byte) (n int, err error) {
+	if c.zr == nil {
+		return 0, io.ErrClosedPipe
+	}
+	return c.zr.Read(p)
+}
+
+// Close закрывает тело запроса и возвращает декодер в пул.
+// Сам декодер не закрывается: zstd.Decoder после Close переиспользовать нельзя.
+func (c *compressReader) Close() error {
+	if c.zr != nil {
+		c.pools.putReader(c.encoding, c.zr)
+		c.zr = nil
+	}
+	return c.r.Close()
+}
@@ -0,0 +1,200 @@
+package compress
+
+import (
+	"github.com/ivanlp-p/ShortLinkService/internal/metrics"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// compressWriter реализует интерфейс http.ResponseWriter и позволяет прозрачно для сервера
+// сжимать передаваемые данные и выставлять правильные HTTP-заголовки.
+// Решение о сжатии откладывается, пока не известны статус, Content-Type
+// и не набралось minSize байт тела.
+type compressWriter struct {
+	w        http.ResponseWriter
+	encoding string
+	minSize  int
+	pools    *pools
+
+	status  int
+	decided bool
+	buf     []byte
+
+	enc     resetWriter
+	counter *countingWriter
+	written int
+}
+
+func newCompressWriter(w http.ResponseWriter, encoding string, minSize int, p *pools) *compressWriter {
+	return &compressWriter{
+		w:        w,
+		encoding: encoding,
+		minSize:  minSize,
+		pools:    p,
+	}
+}
+
+func (c *compressWriter) Header() http.Header {
+	return c.w.Header()
+}
+
+func (c *compressWriter) WriteHeader(statusCode int) {
+	if c.decided || c.status != 0 {
+		return
+	}
+	c.status = statusCode
+	if !bodyAllowed(statusCode) {
+		c.decide(false)
+	}
+}
+
+func (c *compressWriter) Write(p []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	if c.decided {
+		return c.write(p)
+	}
+
+	if !c.eligible() {
+		if err := c.decide(false); err != nil {
+			return 0, err
+		}
+		return c.write(p)
+	}
+
+	c.buf = append(c.buf, p...)
+	if len(c.buf) >= c.minSize {
+		if err := c.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (c *compressWriter) write(p []byte) (int, error) {
+	if c.enc == nil {
+		return c.w.Write(p)
+	}
+	n, err := c.enc.Write(p)
+	c.written += n
+	return n, err
+}
+
+// eligible проверяет заголовки ответа, известные на момент первой записи.
+func (c *compressWriter) eligible() bool {
+	if c.status < 200 || c.status >= 300 || !bodyAllowed(c.status) {
+		return false
+	}
+	h := c.w.Header()
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+	if ct := h.Get("Content-Type"); ct != "" && !isCompressible(ct) {
+		return false
+	}
+	if cl, err := strconv.Atoi(h.Get("Content-Length")); err == nil && cl < c.minSize {
+		return false
+	}
+	return true
+}
+
+// decide фиксирует, сжимается ли ответ, отправляет заголовки и накопленное тело.
+func (c *compressWriter) decide(compress bool) error {
+	c.decided = true
+	h := c.w.Header()
+
+	if len(c.buf) > 0 && h.Get("Content-Type") == "" {
+		// Иначе net/http определит тип по уже сжатым байтам
+		h.Set("Content-Type", http.DetectContentType(c.buf))
+		compress = compress && isCompressible(h.Get("Content-Type"))
+	}
+
+	if compress {
+		c.counter = &countingWriter{w: c.w}
+		enc, err := c.pools.getWriter(c.encoding, c.counter)
+		if err != nil {
+			return err
+		}
+		c.enc = enc
+		h.Set("Content-Encoding", c.encoding)
+		// Длина несжатого тела больше не соответствует ответу
+		h.Del("Content-Length")
+	}
+
+	if c.status != 0 {
+		c.w.WriteHeader(c.status)
+	}
+
+	buf := c.buf
+	c.buf = nil
+	if len(buf) > 0 {
+		if _, err := c.write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close досылает тело: короткие ответы уходят без сжатия,
+// у сжатых закрывается кодировщик и учитывается сэкономленный объём.
+func (c *compressWriter) Close() error {
+	if !c.decided {
+		if err := c.decide(false); err != nil {
+			return err
+		}
+	}
+	if c.enc == nil {
+		return nil
+	}
+	err := c.enc.Close()
+	c.pools.putWriter(c.encoding, c.enc)
+	c.enc = nil
+	if saved := c.written - c.counter.n; saved > 0 {
+		metrics.CompressionBytesSaved.WithLabelValues(c.encoding).Add(float64(saved))
+	}
+	return err
+}
+
+// Flush реализует http.Flusher: досылает всё, что накоплено в буфере и в кодировщике.
+// Для потоковых ответов решение о сжатии принимается в момент первого Flush.
+func (c *compressWriter) Flush() {
+	if !c.decided {
+		if c.status == 0 {
+			c.status = http.StatusOK
+		}
+		// Без Content-Type и тела тип ответа не определить, поэтому такой поток не сжимается
+		compress := c.eligible() && (len(c.buf) > 0 || c.w.Header().Get("Content-Type") != "")
+		if err := c.decide(compress); err != nil {
+			return
+		}
+	}
+	if c.enc != nil {
+		c.enc.Flush()
+	}
+	if f, ok := c.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap позволяет http.ResponseController добраться до исходного ResponseWriter.
+func (c *compressWriter) Unwrap() http.ResponseWriter {
+	return c.w
+}
+
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// countingWriter считает байты, фактически отправленные клиенту после сжатия.
+type countingWriter struct {
+	w io.Writer
+	n int
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += n
+	return n, err
+}
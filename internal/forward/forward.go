@@ -0,0 +1,102 @@
+// Package forward переносит путь и параметры запроса к короткой ссылке
+// в адрес назначения.
+package forward
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// QueryPolicy определяет, как параметры запроса к короткой ссылке
+// объединяются с параметрами адреса назначения.
+type QueryPolicy string
+
+const (
+	// QueryDrop — параметры запроса не переносятся.
+	QueryDrop QueryPolicy = ""
+	// QueryKeepDestination — при совпадении имён остаются параметры адреса назначения.
+	QueryKeepDestination QueryPolicy = "destination"
+	// QueryOverride — при совпадении имён параметры запроса заменяют параметры адреса назначения.
+	QueryOverride QueryPolicy = "incoming"
+	// QueryAppend — сохраняются значения из обоих источников.
+	QueryAppend QueryPolicy = "append"
+)
+
+// Valid сообщает, известна ли политика.
+func (p QueryPolicy) Valid() bool {
+	switch p {
+	case QueryDrop, QueryKeepDestination, QueryOverride, QueryAppend:
+		return true
+	}
+	return false
+}
+
+// Options — настройки переноса для одной ссылки.
+type Options struct {
+	Query QueryPolicy
+	// Path разрешает дописывать к адресу назначения путь после идентификатора ссылки.
+	Path bool
+}
+
+// URL строит итоговый адрес: к destination дописывается extraPath (путь
+// запроса после идентификатора) и сливаются параметры rawQuery по политике opts.Query.
+// Порядок параметров самого адреса назначения сохраняется.
+func URL(destination, extraPath, rawQuery string, opts Options) (string, error) {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return "", fmt.Errorf("parse destination: %w", err)
+	}
+
+	if opts.Path && extraPath != "" {
+		// Clean от корня отбрасывает «..», так что путь не выйдет за пределы пути назначения
+		extra := path.Clean("/" + extraPath)
+		if strings.HasSuffix(extraPath, "/") && extra != "/" {
+			extra += "/"
+		}
+		u.Path = strings.TrimSuffix(u.Path, "/") + extra
+		u.RawPath = ""
+	}
+
+	if opts.Query != QueryDrop && rawQuery != "" {
+		incoming, err := url.ParseQuery(rawQuery)
+		if err != nil {
+			return "", fmt.Errorf("parse query: %w", err)
+		}
+		u.RawQuery = mergeQuery(u.RawQuery, incoming, opts.Query)
+	}
+	return u.String(), nil
+}
+
+// mergeQuery дописывает incoming к исходной строке запроса, не перекодируя её.
+func mergeQuery(raw string, incoming url.Values, policy QueryPolicy) string {
+	var pairs []string
+	existing := make(map[string]bool)
+	for _, pair := range strings.Split(raw, "&") {
+		if pair == "" {
+			continue
+		}
+		key, _, _ := strings.Cut(pair, "=")
+		if k, err := url.QueryUnescape(key); err == nil {
+			key = k
+		}
+		if policy == QueryOverride && incoming.Has(key) {
+			continue
+		}
+		existing[key] = true
+		pairs = append(pairs, pair)
+	}
+
+	add := make(url.Values, len(incoming))
+	for key, values := range incoming {
+		if policy == QueryKeepDestination && existing[key] {
+			continue
+		}
+		add[key] = values
+	}
+	if encoded := add.Encode(); encoded != "" {
+		pairs = append(pairs, encoded)
+	}
+	return strings.Join(pairs, "&")
+}
@@ -0,0 +1,104 @@
+package forward
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestURL(t *testing.T) {
+	tests := []struct {
+		name        string
+		destination string
+		extraPath   string
+		rawQuery    string
+		opts        Options
+		want        string
+	}{
+		{
+			name:        "disabled",
+			destination: "https://example.com/landing?b=2&a=1",
+			extraPath:   "docs",
+			rawQuery:    "utm_source=mail",
+			want:        "https://example.com/landing?b=2&a=1",
+		},
+		{
+			name:        "query_into_empty",
+			destination: "https://example.com/landing",
+			rawQuery:    "utm_source=mail&utm_medium=email",
+			opts:        Options{Query: QueryKeepDestination},
+			want:        "https://example.com/landing?utm_medium=email&utm_source=mail",
+		},
+		{
+			name:        "keep_destination",
+			destination: "https://example.com/landing?utm_source=site&b=2",
+			rawQuery:    "utm_source=mail&utm_campaign=x",
+			opts:        Options{Query: QueryKeepDestination},
+			want:        "https://example.com/landing?utm_source=site&b=2&utm_campaign=x",
+		},
+		{
+			name:        "override",
+			destination: "https://example.com/landing?utm_source=site&b=2",
+			rawQuery:    "utm_source=mail&utm_campaign=x",
+			opts:        Options{Query: QueryOverride},
+			want:        "https://example.com/landing?b=2&utm_campaign=x&utm_source=mail",
+		},
+		{
+			name:        "append",
+			destination: "https://example.com/landing?tag=a",
+			rawQuery:    "tag=b",
+			opts:        Options{Query: QueryAppend},
+			want:        "https://example.com/landing?tag=a&tag=b",
+		},
+		{
+			name:        "escaped_keys",
+			destination: "https://example.com/?q%20x=1",
+			rawQuery:    "q+x=2",
+			opts:        Options{Query: QueryOverride},
+			want:        "https://example.com/?q+x=2",
+		},
+		{
+			name:        "path",
+			destination: "https://example.com/docs/",
+			extraPath:   "guide/install",
+			opts:        Options{Path: true},
+			want:        "https://example.com/docs/guide/install",
+		},
+		{
+			name:        "path_trailing_slash",
+			destination: "https://example.com",
+			extraPath:   "guide/",
+			opts:        Options{Path: true},
+			want:        "https://example.com/guide/",
+		},
+		{
+			name:        "path_traversal",
+			destination: "https://example.com/docs",
+			extraPath:   "../../admin",
+			opts:        Options{Path: true},
+			want:        "https://example.com/docs/admin",
+		},
+		{
+			name:        "path_and_query",
+			destination: "https://example.com/docs?lang=en",
+			extraPath:   "a b",
+			rawQuery:    "lang=de",
+			opts:        Options{Path: true, Query: QueryOverride},
+			want:        "https://example.com/docs/a%20b?lang=de",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := URL(tt.destination, tt.extraPath, tt.rawQuery, tt.opts)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestQueryPolicy_Valid(t *testing.T) {
+	for _, p := range []QueryPolicy{QueryDrop, QueryKeepDestination, QueryOverride, QueryAppend} {
+		assert.True(t, p.Valid())
+	}
+	assert.False(t, QueryPolicy("merge").Valid())
+}
@@ -0,0 +1,211 @@
+// Package geoip определяет страну по IP-адресу по локальной базе диапазонов.
+// Внешние сервисы не используются.
+//
+// Формат файла — CSV, одна запись в строке:
+//
+//	# комментарий
+//	1.0.0.0,1.0.0.255,AU        первый и последний адрес диапазона
+//	2001:200::/32,JP            диапазон в нотации CIDR
+//	"16777216","16777471","AU"  адреса IPv4 числами, как в IP2Location LITE
+//
+// Записи со страной «-» (неизвестна) пропускаются. Диапазоны не должны пересекаться.
+package geoip
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type ipRange struct {
+	first   netip.Addr
+	last    netip.Addr
+	country string
+}
+
+// table — неизменяемый набор диапазонов, отсортированный по первому адресу.
+type table struct {
+	ranges []ipRange
+}
+
+// parse разбирает базу. Ошибки в строках собираются вместе с номерами строк.
+func parse(r io.Reader) (*table, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	t := &table{}
+	var errs []string
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		line, _ := cr.FieldPos(0)
+		if err != nil {
+			return nil, fmt.Errorf("geoip: %w", err)
+		}
+		rng, skip, err := parseRecord(record)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("line %d: %v", line, err))
+			continue
+		}
+		if !skip {
+			t.ranges = append(t.ranges, rng)
+		}
+	}
+
+	slices.SortFunc(t.ranges, func(a, b ipRange) int { return a.first.Compare(b.first) })
+	for i := 1; i < len(t.ranges); i++ {
+		prev, cur := t.ranges[i-1], t.ranges[i]
+		if cur.first.Compare(prev.last) <= 0 {
+			errs = append(errs, fmt.Sprintf("range %s-%s overlaps %s-%s", cur.first, cur.last, prev.first, prev.last))
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("geoip: %s", strings.Join(errs, "; "))
+	}
+	return t, nil
+}
+
+func parseRecord(record []string) (rng ipRange, skip bool, err error) {
+	switch len(record) {
+	case 2:
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(record[0]))
+		if err != nil {
+			return ipRange{}, false, err
+		}
+		prefix = prefix.Masked()
+		rng.first, rng.last = prefix.Addr(), lastAddr(prefix)
+	case 3:
+		if rng.first, err = parseAddr(record[0]); err != nil {
+			return ipRange{}, false, err
+		}
+		if rng.last, err = parseAddr(record[1]); err != nil {
+			return ipRange{}, false, err
+		}
+		if rng.first.Is4() != rng.last.Is4() {
+			return ipRange{}, false, errors.New("range mixes IPv4 and IPv6")
+		}
+		if rng.first.Compare(rng.last) > 0 {
+			return ipRange{}, false, fmt.Errorf("range start %s is after end %s", rng.first, rng.last)
+		}
+	default:
+		return ipRange{}, false, fmt.Errorf("expected 2 or 3 fields, got %d", len(record))
+	}
+
+	country := strings.ToUpper(strings.TrimSpace(record[len(record)-1]))
+	if country == "-" {
+		return ipRange{}, true, nil
+	}
+	if !ValidCountry(country) {
+		return ipRange{}, false, fmt.Errorf("country %q: must be a two-letter ISO 3166 code", country)
+	}
+	rng.country = country
+	return rng, false, nil
+}
+
+func parseAddr(s string) (netip.Addr, error) {
+	s = strings.TrimSpace(s)
+	if n, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return netip.AddrFrom4([4]byte{byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return addr.Unmap(), nil
+}
+
+// lastAddr возвращает последний адрес диапазона prefix.
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	b := prefix.Addr().AsSlice()
+	for i := prefix.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
+
+func (t *table) lookup(addr netip.Addr) (string, bool) {
+	// Ищем последний диапазон, начинающийся не позже addr
+	i, found := slices.BinarySearchFunc(t.ranges, addr, func(r ipRange, a netip.Addr) int { return r.first.Compare(a) })
+	if !found {
+		i--
+	}
+	if i < 0 || t.ranges[i].last.Compare(addr) < 0 {
+		return "", false
+	}
+	return t.ranges[i].country, true
+}
+
+// ValidCountry сообщает, похоже ли code на код страны ISO 3166-1 alpha-2 в верхнем регистре.
+func ValidCountry(code string) bool {
+	return len(code) == 2 && code[0] >= 'A' && code[0] <= 'Z' && code[1] >= 'A' && code[1] <= 'Z'
+}
+
+// DB — база диапазонов, загруженная из файла. Перезагрузка не мешает
+// параллельным поискам.
+type DB struct {
+	table atomic.Pointer[table]
+	mu    sync.Mutex
+}
+
+// New загружает базу из path. Пустой path означает пустую базу.
+func New(path string) (*DB, error) {
+	db := &DB{}
+	if err := db.Reload(path); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Reload перечитывает базу из path. При ошибке остаётся прежняя база.
+func (db *DB) Reload(path string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if path == "" {
+		db.table.Store(&table{})
+		return nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("geoip: %w", err)
+	}
+	defer file.Close()
+
+	t, err := parse(file)
+	if err != nil {
+		return err
+	}
+	db.table.Store(t)
+	return nil
+}
+
+// Country возвращает код страны для ip. ok == false, если адрес не разобран
+// или не входит ни в один диапазон.
+func (db *DB) Country(ip string) (country string, ok bool) {
+	if db == nil {
+		return "", false
+	}
+	t := db.table.Load()
+	if t == nil {
+		return "", false
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return "", false
+	}
+	return t.lookup(addr.Unmap())
+}
@@ -0,0 +1,83 @@
+package geoip
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testDB = `# test ranges
+1.0.0.0,1.0.0.255,au
+"16777472","16778239","CN"
+2.16.0.0/13, DE
+2001:200::/32,JP
+10.0.0.0,10.255.255.255,-
+`
+
+func TestParse(t *testing.T) {
+	tbl, err := parse(strings.NewReader(testDB))
+	require.NoError(t, err)
+
+	tests := []struct {
+		ip     string
+		want   string
+		wantOK bool
+	}{
+		{ip: "1.0.0.0", want: "AU", wantOK: true},
+		{ip: "1.0.0.255", want: "AU", wantOK: true},
+		{ip: "1.0.1.0", want: "CN", wantOK: true},
+		{ip: "1.0.3.255", want: "CN", wantOK: true},
+		{ip: "1.0.4.0"},
+		{ip: "2.23.255.255", want: "DE", wantOK: true},
+		{ip: "2001:200:ffff::1", want: "JP", wantOK: true},
+		{ip: "2001:201::1"},
+		{ip: "10.1.2.3"},
+		{ip: "0.0.0.1"},
+		{ip: "255.255.255.255"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			db := &DB{}
+			db.table.Store(tbl)
+			got, ok := db.Country(tt.ip)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	_, err := parse(strings.NewReader("1.0.0.0,1.0.0.255,AU\n1.0.0.128,1.0.1.0,CN\nbad,1.0.0.1,US\n2.0.0.9,2.0.0.1,US\n3.0.0.0,3.0.0.1,USA\n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "line 3")
+	assert.Contains(t, err.Error(), "line 4: range start")
+	assert.Contains(t, err.Error(), "line 5: country")
+	assert.Contains(t, err.Error(), "overlaps")
+}
+
+func TestDB_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "geo.csv")
+	require.NoError(t, os.WriteFile(path, []byte("1.0.0.0/24,AU\n"), 0644))
+
+	db, err := New(path)
+	require.NoError(t, err)
+	country, _ := db.Country("1.0.0.1")
+	assert.Equal(t, "AU", country)
+
+	require.NoError(t, os.WriteFile(path, []byte("1.0.0.0/24,NZ\n"), 0644))
+	require.NoError(t, db.Reload(path))
+	country, _ = db.Country("1.0.0.1")
+	assert.Equal(t, "NZ", country)
+
+	require.NoError(t, os.WriteFile(path, []byte("garbage\n"), 0644))
+	require.Error(t, db.Reload(path))
+	country, _ = db.Country("::ffff:1.0.0.1")
+	assert.Equal(t, "NZ", country, "failed reload must keep the previous database")
+
+	var nilDB *DB
+	_, ok := nilDB.Country("1.0.0.1")
+	assert.False(t, ok)
+}
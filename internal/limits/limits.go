@@ -0,0 +1,35 @@
+package limits
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Body ограничивает размер сырого тела запроса, ещё до распаковки.
+// При превышении лимита чтение тела возвращает *http.MaxBytesError.
+func Body(maxBytes int64, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > maxBytes {
+			TooLarge(w, "request body", maxBytes)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+		h(w, r)
+	}
+}
+
+// IsTooLarge сообщает, что ошибка чтения тела вызвана превышением лимита.
+// Если это так, возвращает сам лимит.
+func IsTooLarge(err error) (int64, bool) {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return maxErr.Limit, true
+	}
+	return 0, false
+}
+
+// TooLarge отвечает 413 Payload Too Large с указанием, какой лимит превышен.
+func TooLarge(w http.ResponseWriter, what string, limit int64) {
+	http.Error(w, fmt.Sprintf("Payload Too Large: %s exceeds %d bytes", what, limit), http.StatusRequestEntityTooLarge)
+}
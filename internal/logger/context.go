@@ -0,0 +1,56 @@
+package logger
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// RequestIDHeader — заголовок, в котором клиент может передать свой идентификатор запроса.
+// Сервер всегда возвращает идентификатор в этом же заголовке ответа.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength ограничивает длину идентификатора, принятого от клиента.
+const maxRequestIDLength = 128
+
+type ctxKey int
+
+const (
+	loggerKey ctxKey = iota
+	requestIDKey
+)
+
+// FromContext возвращает логгер запроса, а если его нет — общий Log.
+func FromContext(ctx context.Context) *zap.Logger {
+	if l, ok := ctx.Value(loggerKey).(*zap.Logger); ok {
+		return l
+	}
+	return Log
+}
+
+// WithContext кладёт логгер в контекст.
+func WithContext(ctx context.Context, l *zap.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, l)
+}
+
+// RequestID возвращает идентификатор текущего запроса или пустую строку.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// requestID берёт идентификатор из заголовка запроса, если он корректен,
+// иначе генерирует новый.
+func requestID(r *http.Request) string {
+	id := r.Header.Get(RequestIDHeader)
+	if id == "" || len(id) > maxRequestIDLength {
+		return uuid.NewString()
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return uuid.NewString()
+		}
+	}
+	return id
+}
@@ -1,6 +1,9 @@
 package logger
 
 import (
+	"context"
+	"github.com/go-chi/chi/v5"
+	"github.com/ivanlp-p/ShortLinkService/internal/metrics"
 	"go.uber.org/zap"
 	"net/http"
 	"strconv"
@@ -9,15 +12,18 @@ import (
 
 var Log *zap.Logger = zap.NewNop()
 
+// Level — текущий уровень логирования. Его можно менять на лету через SetLevel,
+// не пересоздавая Log.
+var Level = zap.NewAtomicLevel()
+
 func Initialize(level string) error {
-	lvl, err := zap.ParseAtomicLevel(level)
-	if err != nil {
+	if err := SetLevel(level); err != nil {
 		return err
 	}
 
 	cfg := zap.NewProductionConfig()
 
-	cfg.Level = lvl
+	cfg.Level = Level
 
 	zl, err := cfg.Build()
 	if err != nil {
@@ -29,6 +35,16 @@ func Initialize(level string) error {
 	return nil
 }
 
+// SetLevel меняет уровень логирования уже работающего логгера.
+func SetLevel(level string) error {
+	lvl, err := zap.ParseAtomicLevel(level)
+	if err != nil {
+		return err
+	}
+	Level.SetLevel(lvl.Level())
+	return nil
+}
+
 type (
 	responseData struct {
 		status int
@@ -54,10 +70,27 @@ func (r *loggingResponseWriter) WriteHeader(statusCode int) {
 	r.responseData.status = statusCode // захватываем код статуса
 }
 
+// Flush пробрасывает http.Flusher, чтобы потоковые ответы не буферизовались.
+func (r *loggingResponseWriter) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
 func RequestLogger(h http.Handler) http.HandlerFunc {
 	logFunc := func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
+		id := requestID(r)
+		w.Header().Set(RequestIDHeader, id)
+		reqLog := Log.With(zap.String("request_id", id))
+		ctx := context.WithValue(r.Context(), requestIDKey, id)
+		r = r.WithContext(WithContext(ctx, reqLog))
+
 		responseData := &responseData{
 			status: 0,
 			size:   0,
@@ -71,12 +104,21 @@ func RequestLogger(h http.Handler) http.HandlerFunc {
 
 		duration := time.Since(start)
 
-		Log.Info("Request",
+		var route string
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			route = rctx.RoutePattern()
+		}
+		metrics.ObserveRequest(route, r.Method, responseData.status, duration)
+
+		reqLog.Info("Request",
 			zap.String("uri", r.RequestURI),
 			zap.String("method", r.Method),
 			zap.String("duration", duration.String()),
+			zap.Float64("latency_ms", float64(duration.Microseconds())/1000),
 			zap.String("status", strconv.Itoa(responseData.status)),
 			zap.String("size", strconv.Itoa(responseData.size)),
+			zap.String("remote_addr", r.RemoteAddr),
+			zap.String("user_agent", r.UserAgent()),
 		)
 	}
 	return logFunc
@@ -0,0 +1,79 @@
+package logger
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestLogger_RequestID(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	Log = zap.New(core)
+	t.Cleanup(func() { Log = zap.NewNop() })
+
+	tests := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{
+			name:     "accept_client_id",
+			incoming: "abc-123",
+			keep:     true,
+		},
+		{
+			name: "generate_when_missing",
+		},
+		{
+			name:     "replace_invalid_id",
+			incoming: "bad id\n",
+		},
+		{
+			name:     "replace_too_long_id",
+			incoming: strings.Repeat("a", maxRequestIDLength+1),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.TakeAll()
+
+			var handlerID string
+			h := RequestLogger(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handlerID = RequestID(r.Context())
+				FromContext(r.Context()).Info("inside handler")
+				w.WriteHeader(http.StatusCreated)
+			}))
+
+			request := httptest.NewRequest(http.MethodPost, "/", nil)
+			if tt.incoming != "" {
+				request.Header.Set(RequestIDHeader, tt.incoming)
+			}
+			w := httptest.NewRecorder()
+			h(w, request)
+
+			responseID := w.Header().Get(RequestIDHeader)
+			assert.NotEmpty(t, responseID)
+			assert.Equal(t, responseID, handlerID)
+			if tt.keep {
+				assert.Equal(t, tt.incoming, responseID)
+			} else {
+				assert.NotEqual(t, tt.incoming, responseID)
+			}
+
+			entries := logs.All()
+			if assert.Len(t, entries, 2) {
+				for _, e := range entries {
+					assert.Equal(t, responseID, e.ContextMap()["request_id"])
+				}
+				access := entries[1].ContextMap()
+				assert.Contains(t, access, "latency_ms")
+				assert.Contains(t, access, "remote_addr")
+				assert.Contains(t, access, "user_agent")
+			}
+		})
+	}
+}
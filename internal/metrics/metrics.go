@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const namespace = "shortener"
+
+// Registry — собственный реестр сервиса, чтобы в /metrics не попадали
+// метрики из глобального реестра сторонних библиотек.
+var Registry = prometheus.NewRegistry()
+
+var (
+	RequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests by route pattern, method and status.",
+	}, []string{"route", "method", "status"})
+
+	RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route pattern, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	StorageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storage_operation_duration_seconds",
+		Help:      "Storage operation latency.",
+		Buckets:   []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1},
+	}, []string{"operation"})
+
+	StorageErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "storage_errors_total",
+		Help:      "Number of failed storage operations.",
+	}, []string{"operation"})
+
+	StoredLinks = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "stored_links",
+		Help:      "Number of short links in storage.",
+	})
+
+	RedirectsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "redirects_total",
+		Help:      "Number of redirects served.",
+	})
+
+	CompressionBytesSaved = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "compression_bytes_saved_total",
+		Help:      "Difference between uncompressed and compressed response sizes by content encoding.",
+	}, []string{"encoding"})
+)
+
+func init() {
+	Registry.MustRegister(
+		RequestsTotal,
+		RequestDuration,
+		StorageDuration,
+		StorageErrors,
+		StoredLinks,
+		RedirectsTotal,
+		CompressionBytesSaved,
+	)
+}
+
+// Handler отдаёт метрики в текстовом формате Prometheus.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest учитывает завершённый HTTP-запрос.
+// Пустой route означает, что запрос не попал ни в один маршрут.
+func ObserveRequest(route, method string, status int, duration time.Duration) {
+	if route == "" {
+		route = "unmatched"
+	}
+	// Если обработчик не вызвал WriteHeader, net/http отвечает 200
+	if status == 0 {
+		status = http.StatusOK
+	}
+	code := strconv.Itoa(status)
+	RequestsTotal.WithLabelValues(route, method, code).Inc()
+	RequestDuration.WithLabelValues(route, method, code).Observe(duration.Seconds())
+}
+
+// ObserveStorage учитывает длительность операции хранилища и её ошибку, если она была.
+func ObserveStorage(operation string, start time.Time, err error) {
+	StorageDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		StorageErrors.WithLabelValues(operation).Inc()
+	}
+}
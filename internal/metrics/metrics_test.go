@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	ObserveRequest("/{id}", http.MethodGet, http.StatusTemporaryRedirect, 5*time.Millisecond)
+	ObserveRequest("/", http.MethodPost, 0, time.Millisecond)
+	RedirectsTotal.Inc()
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	result := w.Result()
+	body, err := io.ReadAll(result.Body)
+	require.NoError(t, err)
+	require.NoError(t, result.Body.Close())
+
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Contains(t, string(body), `shortener_http_requests_total{method="GET",route="/{id}",status="307"} 1`)
+	assert.Contains(t, string(body), `shortener_http_requests_total{method="POST",route="/",status="200"} 1`)
+	assert.Contains(t, string(body), `shortener_http_request_duration_seconds_bucket{method="GET",route="/{id}",status="307",le="0.005"} 1`)
+	assert.Contains(t, string(body), "shortener_redirects_total 1")
+}
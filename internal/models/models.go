@@ -1,15 +1,174 @@
 package models
 
+import "time"
+
 type ShortURL struct {
 	Result string `json:"result"`
 }
 
 type OriginalURL struct {
-	URL string `json:"url"`
+	URL          string `json:"url"`
+	Interstitial bool   `json:"interstitial,omitempty"`
+	// RedirectStatus — 301, 302, 307 или 308; 0 — код по умолчанию из конфигурации.
+	RedirectStatus int `json:"redirect_status,omitempty"`
+	// ForwardQuery — политика переноса параметров запроса: destination, incoming или append.
+	ForwardQuery string `json:"forward_query,omitempty"`
+	ForwardPath  bool   `json:"forward_path,omitempty"`
+
+	Targeting *Targeting `json:"targeting,omitempty"`
+
+	Variants      []Variant `json:"variants,omitempty"`
+	StickyVariant bool      `json:"sticky_variant,omitempty"`
+
+	// Password — пароль для перехода по ссылке; сохраняется только его хеш.
+	Password string `json:"password,omitempty"`
+	// MaxClicks — число переходов, после которого ссылка перестаёт работать.
+	MaxClicks int64 `json:"max_clicks,omitempty"`
+
+	// ActiveFrom и ActiveUntil — окно действия ссылки в RFC 3339.
+	ActiveFrom  *time.Time `json:"active_from,omitempty"`
+	ActiveUntil *time.Time `json:"active_until,omitempty"`
+
+	// Title, Notes и Tags — описание ссылки для поиска в списке пользователя.
+	Title string   `json:"title,omitempty"`
+	Notes string   `json:"notes,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
 }
 
 type ShortLink struct {
-	UUID        string `json:"uuid"`
-	ShortURL    string `json:"short_url"`
-	OriginalURL string `json:"original_url"`
+	UUID        string    `json:"uuid"`
+	ShortURL    string    `json:"short_url"`
+	OriginalURL string    `json:"original_url"`
+	CreatedAt   time.Time `json:"created_at"`
+	// Interstitial — перед переходом всегда показывать страницу предпросмотра.
+	Interstitial bool `json:"interstitial,omitempty"`
+	// RedirectStatus — код ответа при переходе; 0 — код по умолчанию из конфигурации.
+	RedirectStatus int `json:"redirect_status,omitempty"`
+	// ForwardQuery — как переносить параметры запроса в адрес назначения, см. forward.QueryPolicy.
+	ForwardQuery string `json:"forward_query,omitempty"`
+	// ForwardPath — дописывать к адресу назначения путь после идентификатора.
+	ForwardPath bool `json:"forward_path,omitempty"`
+	// Targeting — правила выбора адреса назначения; OriginalURL используется, если ни одно не подошло.
+	Targeting *Targeting `json:"targeting,omitempty"`
+	// Variants — адреса для A/B-теста; если заданы, заменяют OriginalURL,
+	// когда не сработало ни одно правило Targeting.
+	Variants []Variant `json:"variants,omitempty"`
+	// StickyVariant — запоминать показанный вариант в cookie посетителя.
+	StickyVariant bool `json:"sticky_variant,omitempty"`
+	// PasswordHash — солёный хеш пароля, см. protect.HashPassword; пустой — ссылка открыта.
+	PasswordHash string `json:"password_hash,omitempty"`
+	// MaxClicks — после стольких переходов ссылка перестаёт работать; 0 — без ограничения.
+	MaxClicks int64 `json:"max_clicks,omitempty"`
+	// UsedClicks — число переходов по ссылке с MaxClicks на момент записи в файл.
+	// Нужно только для восстановления счётчика при загрузке; в памяти всегда 0.
+	UsedClicks int64 `json:"used_clicks,omitempty"`
+	// ActiveFrom — до этого момента ссылка ведёт себя как несуществующая; nil — действует сразу.
+	ActiveFrom *time.Time `json:"active_from,omitempty"`
+	// ActiveUntil — с этого момента ссылка отвечает 410 Gone; nil — действует бессрочно.
+	ActiveUntil *time.Time `json:"active_until,omitempty"`
+	// Title и Notes — название и заметки владельца; на переход не влияют.
+	Title string `json:"title,omitempty"`
+	Notes string `json:"notes,omitempty"`
+	// Tags — метки ссылки в нижнем регистре, без повторов и по алфавиту.
+	Tags []string `json:"tags,omitempty"`
+	// UserID — владелец ссылки; только он может её изменять.
+	UserID string `json:"user_id,omitempty"`
+	// Version — номер версии, увеличивается при каждом сохранении ссылки.
+	Version int `json:"version,omitempty"`
+	// UpdatedBy и UpdatedAt — кто и когда сохранил эту версию.
+	UpdatedBy string    `json:"updated_by,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Clicks — число переходов; заполняется хранилищем и в файл не пишется.
+	Clicks int64 `json:"-"`
+}
+
+// Targeting — правила выбора адреса назначения в зависимости от посетителя.
+// Правила каждого вида проверяются по порядку, срабатывает первое подходящее.
+type Targeting struct {
+	Device   []DeviceRule   `json:"device,omitempty"`
+	Country  []CountryRule  `json:"country,omitempty"`
+	Language []LanguageRule `json:"language,omitempty"`
+}
+
+// DeviceRule срабатывает, если User-Agent подходит под все заданные условия.
+// Пустое условие подходит под любое значение.
+type DeviceRule struct {
+	OS     string `json:"os,omitempty"`
+	Device string `json:"device,omitempty"`
+	Bot    *bool  `json:"bot,omitempty"`
+	URL    string `json:"url"`
+}
+
+// CountryRule срабатывает, если страна посетителя (ISO 3166-1 alpha-2) есть в Countries.
+type CountryRule struct {
+	Countries []string `json:"countries"`
+	URL       string   `json:"url"`
+}
+
+// LanguageRule — адрес для языков Languages (теги BCP 47, например "de" или "pt-BR").
+// В отличие от других правил, выбирается не первое подходящее, а лучше всего
+// подходящее под Accept-Language посетителя с учётом весов.
+type LanguageRule struct {
+	Languages []string `json:"languages"`
+	URL       string   `json:"url"`
+}
+
+// Variant — один из адресов назначения A/B-теста. Вероятность показа
+// пропорциональна Weight.
+type Variant struct {
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+}
+
+// Click — сведения об одном переходе по ссылке.
+type Click struct {
+	Variant string
+	Country string
+}
+
+// LinkInfo — ссылка со всеми настройками, как её видит владелец.
+type LinkInfo struct {
+	ShortURL string `json:"short_url"`
+	OriginalURL
+	// Protected — у ссылки есть пароль; сам пароль не возвращается.
+	Protected bool      `json:"protected,omitempty"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedBy string    `json:"updated_by,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// LinkFilter — условия поиска ссылок пользователя.
+type LinkFilter struct {
+	UserID string
+	// Tag — ссылка должна иметь эту метку; пустая строка — любые метки.
+	Tag string
+	// Query — подстрока названия или исходного адреса без учёта регистра.
+	Query string
+}
+
+// LinkVersion — запись истории изменений ссылки.
+type LinkVersion struct {
+	Version     int       `json:"version"`
+	OriginalURL string    `json:"original_url"`
+	UpdatedBy   string    `json:"updated_by,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Rollback — запрос на возврат ссылки к одной из прежних версий.
+type Rollback struct {
+	Version int `json:"version"`
+}
+
+// LinkStats — статистика переходов по ссылке.
+type LinkStats struct {
+	Clicks    int64            `json:"clicks"`
+	Variants  map[string]int64 `json:"variants,omitempty"`
+	Countries map[string]int64 `json:"countries,omitempty"`
+}
+
+type ReloadResult struct {
+	Status          string   `json:"status"`
+	RestartRequired []string `json:"restart_required,omitempty"`
 }
@@ -0,0 +1,151 @@
+package normalize
+
+import (
+	"fmt"
+	"golang.org/x/net/idna"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Error описывает, почему URL не прошёл проверку.
+type Error struct {
+	Reason string
+}
+
+func (e *Error) Error() string {
+	return "invalid URL: " + e.Reason
+}
+
+func invalid(format string, args ...any) *Error {
+	return &Error{Reason: fmt.Sprintf(format, args...)}
+}
+
+// Options задаёт правила нормализации.
+type Options struct {
+	// AllowedSchemes — допустимые схемы в нижнем регистре.
+	AllowedSchemes []string
+	// StripFragment удаляет #fragment: он не передаётся серверу и не влияет на ресурс.
+	StripFragment bool
+	// SortQuery сортирует параметры запроса по имени.
+	SortQuery bool
+}
+
+// DefaultOptions разрешает только http и https и не трогает fragment и query.
+func DefaultOptions() Options {
+	return Options{
+		AllowedSchemes: []string{"http", "https"},
+	}
+}
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ftp":   "21",
+	"ws":    "80",
+	"wss":   "443",
+}
+
+// Normalizer проверяет и приводит URL к каноническому виду, чтобы
+// эквивалентные адреса получали один и тот же короткий код.
+type Normalizer struct {
+	opts    Options
+	schemes map[string]bool
+}
+
+func New(opts Options) *Normalizer {
+	schemes := make(map[string]bool, len(opts.AllowedSchemes))
+	for _, s := range opts.AllowedSchemes {
+		schemes[strings.ToLower(s)] = true
+	}
+	return &Normalizer{opts: opts, schemes: schemes}
+}
+
+// Normalize возвращает каноническую форму raw или *Error с причиной отказа.
+func (n *Normalizer) Normalize(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", invalid("empty")
+	}
+	if strings.ContainsAny(raw, " \t\r\n") {
+		return "", invalid("contains whitespace")
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", invalid("%s", strings.TrimPrefix(err.Error(), "parse "))
+	}
+	if u.Scheme == "" {
+		return "", invalid("must be absolute, with a scheme such as https://")
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if !n.schemes[scheme] {
+		return "", invalid("scheme %q is not allowed", scheme)
+	}
+	if u.Opaque != "" || u.Host == "" {
+		return "", invalid("missing host")
+	}
+	u.Scheme = scheme
+
+	host, err := normalizeHost(u.Hostname())
+	if err != nil {
+		return "", err
+	}
+	port := u.Port()
+	if port == defaultPorts[scheme] {
+		port = ""
+	}
+	if strings.Contains(host, ":") {
+		// IPv6-литерал
+		host = "[" + host + "]"
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	u.Host = host
+
+	// Пустой путь и "/" эквивалентны; выбираем пустой, чтобы не менять
+	// коды уже сокращённых адресов вида https://example.com
+	if u.Path == "/" && u.RawQuery == "" && !u.ForceQuery {
+		u.Path = ""
+		u.RawPath = ""
+	}
+
+	if n.opts.StripFragment {
+		u.Fragment = ""
+		u.RawFragment = ""
+	}
+	if n.opts.SortQuery && u.RawQuery != "" {
+		u.RawQuery = sortQuery(u.RawQuery)
+	}
+
+	return u.String(), nil
+}
+
+func normalizeHost(host string) (string, error) {
+	if host == "" {
+		return "", invalid("missing host")
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String(), nil
+	}
+	host = strings.TrimSuffix(host, ".")
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return "", invalid("host %q: %v", host, err)
+	}
+	return strings.ToLower(ascii), nil
+}
+
+// sortQuery сортирует параметры по имени, сохраняя порядок значений
+// одного параметра и исходное кодирование.
+func sortQuery(rawQuery string) string {
+	params := strings.Split(rawQuery, "&")
+	sort.SliceStable(params, func(i, j int) bool {
+		ki, _, _ := strings.Cut(params[i], "=")
+		kj, _, _ := strings.Cut(params[j], "=")
+		return ki < kj
+	})
+	return strings.Join(params, "&")
+}
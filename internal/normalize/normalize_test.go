@@ -0,0 +1,140 @@
+package normalize
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestNormalizer_Normalize(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		raw     string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "unchanged",
+			raw:  "https://rcimbvs.com/iuymedy",
+			want: "https://rcimbvs.com/iuymedy",
+		},
+		{
+			name: "lowercase_scheme_and_host",
+			raw:  "HTTPS://Practicum.Yandex.RU/Path",
+			want: "https://practicum.yandex.ru/Path",
+		},
+		{
+			name: "root_path_equals_empty",
+			raw:  "https://practicum.yandex.ru/",
+			want: "https://practicum.yandex.ru",
+		},
+		{
+			name: "default_port_removed",
+			raw:  "http://example.com:80/a",
+			want: "http://example.com/a",
+		},
+		{
+			name: "non_default_port_kept",
+			raw:  "https://example.com:8443/a",
+			want: "https://example.com:8443/a",
+		},
+		{
+			name: "idn_to_punycode",
+			raw:  "https://пример.рф/путь",
+			want: "https://xn--e1afmkfd.xn--p1ai/%D0%BF%D1%83%D1%82%D1%8C",
+		},
+		{
+			name: "ipv6_literal",
+			raw:  "http://[2001:DB8::1]:80/",
+			want: "http://[2001:db8::1]",
+		},
+		{
+			name: "trailing_dot_in_host",
+			raw:  "https://example.com./a",
+			want: "https://example.com/a",
+		},
+		{
+			name: "fragment_kept_by_default",
+			raw:  "https://example.com/a#top",
+			want: "https://example.com/a#top",
+		},
+		{
+			name: "fragment_stripped",
+			opts: Options{AllowedSchemes: []string{"https"}, StripFragment: true},
+			raw:  "https://example.com/a#top",
+			want: "https://example.com/a",
+		},
+		{
+			name: "query_sorted",
+			opts: Options{AllowedSchemes: []string{"https"}, SortQuery: true},
+			raw:  "https://example.com/a?b=2&a=1&b=1",
+			want: "https://example.com/a?a=1&b=2&b=1",
+		},
+		{
+			name:    "not_a_url",
+			raw:     "not a url",
+			wantErr: "whitespace",
+		},
+		{
+			name:    "relative",
+			raw:     "example.com/a",
+			wantErr: "must be absolute",
+		},
+		{
+			name:    "javascript",
+			raw:     "javascript:alert(1)",
+			wantErr: `scheme "javascript" is not allowed`,
+		},
+		{
+			name:    "missing_host",
+			raw:     "https:///path",
+			wantErr: "missing host",
+		},
+		{
+			name:    "scheme_not_allowed",
+			opts:    Options{AllowedSchemes: []string{"https"}},
+			raw:     "http://example.com",
+			wantErr: `scheme "http" is not allowed`,
+		},
+		{
+			name:    "empty",
+			raw:     "  ",
+			wantErr: "empty",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			if opts.AllowedSchemes == nil {
+				opts = DefaultOptions()
+			}
+			got, err := New(opts).Normalize(tt.raw)
+			if tt.wantErr != "" {
+				var nerr *Error
+				require.True(t, errors.As(err, &nerr), "error must be *Error, got %v", err)
+				assert.Contains(t, nerr.Reason, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNormalizer_Equivalent(t *testing.T) {
+	n := New(Options{AllowedSchemes: []string{"http", "https"}, StripFragment: true, SortQuery: true})
+	variants := []string{
+		"https://example.com/page?a=1&b=2",
+		"HTTPS://EXAMPLE.com:443/page?b=2&a=1",
+		"https://example.com./page?a=1&b=2#section",
+	}
+	want, err := n.Normalize(variants[0])
+	require.NoError(t, err)
+	for _, v := range variants[1:] {
+		got, err := n.Normalize(v)
+		require.NoError(t, err)
+		assert.Equal(t, want, got, v)
+	}
+}
@@ -0,0 +1,48 @@
+package preview
+
+import (
+	"html/template"
+	"net/http"
+	"time"
+)
+
+var pageTemplate = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>{{if .Interstitial}}You are leaving {{.ShortURL}}{{else}}Preview of {{.ShortURL}}{{end}}</title>
+</head>
+<body>
+{{if .Interstitial}}<h1>Check the destination before you continue</h1>
+<p>The owner of this short link asked us to show where it leads before redirecting you.</p>
+{{else}}<h1>Short link preview</h1>
+{{end}}<dl>
+<dt>Short link</dt><dd>{{.ShortURL}}</dd>
+<dt>Destination</dt><dd>{{.Destination}}</dd>
+{{if not .CreatedAt.IsZero}}<dt>Created</dt><dd>{{.CreatedAt.UTC.Format "2006-01-02 15:04 MST"}}</dd>
+{{end}}<dt>Clicks</dt><dd>{{.Clicks}}</dd>
+</dl>
+<p><a href="{{.Destination}}" rel="noopener noreferrer nofollow">Continue to {{.Destination}}</a></p>
+</body>
+</html>
+`))
+
+// Page — данные страницы предпросмотра короткой ссылки.
+type Page struct {
+	ShortURL    string
+	Destination string
+	CreatedAt   time.Time
+	Clicks      int64
+	// Interstitial — страница показана вместо редиректа, а не по запросу предпросмотра.
+	Interstitial bool
+}
+
+// WritePage отвечает HTML-страницей с адресом назначения ссылки.
+// Все значения экранируются html/template.
+func WritePage(w http.ResponseWriter, page Page) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	pageTemplate.Execute(w, page)
+}
@@ -0,0 +1,64 @@
+package preview
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWritePage(t *testing.T) {
+	tests := []struct {
+		name        string
+		page        Page
+		contains    []string
+		notContains []string
+	}{
+		{
+			name: "preview",
+			page: Page{
+				ShortURL:    "http://localhost:8080/abc",
+				Destination: "https://example.com/?q=<b>",
+				CreatedAt:   time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+				Clicks:      42,
+			},
+			contains:    []string{"Short link preview", "2024-05-01 12:30 UTC", "<dd>42</dd>", "?q=&lt;b&gt;", `href="https://example.com/?q=%3cb%3e"`},
+			notContains: []string{"<b>", "Check the destination"},
+		},
+		{
+			name: "interstitial",
+			page: Page{
+				ShortURL:     "http://localhost:8080/abc",
+				Destination:  "https://example.com/",
+				Interstitial: true,
+			},
+			contains:    []string{"Check the destination"},
+			notContains: []string{"Created"},
+		},
+		{
+			name: "unsafe_scheme",
+			page: Page{
+				ShortURL:    "http://localhost:8080/abc",
+				Destination: "javascript:alert(1)",
+			},
+			notContains: []string{`href="javascript:`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			WritePage(w, tt.page)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+			assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+			for _, s := range tt.contains {
+				assert.Contains(t, w.Body.String(), s)
+			}
+			for _, s := range tt.notContains {
+				assert.NotContains(t, w.Body.String(), s)
+			}
+		})
+	}
+}
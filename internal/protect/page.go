@@ -0,0 +1,42 @@
+package protect
+
+import (
+	"html/template"
+	"net/http"
+)
+
+var formTemplate = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>{{.ShortURL}} is password protected</title>
+</head>
+<body>
+<h1>This link is password protected</h1>
+<p>Enter the password to continue to the destination of {{.ShortURL}}.</p>
+{{if .Error}}<p role="alert">{{.Error}}</p>
+{{end}}<form method="post" action="{{.Action}}">
+<label for="password">Password</label>
+<input type="password" id="password" name="password" autocomplete="current-password" required autofocus>
+<button type="submit">Continue</button>
+</form>
+</body>
+</html>
+`))
+
+// Form — данные страницы ввода пароля.
+type Form struct {
+	ShortURL string
+	// Action — адрес, на который отправляется форма (обычно адрес самой ссылки).
+	Action string
+	Error  string
+}
+
+// WriteForm отвечает страницей ввода пароля с кодом status.
+func WriteForm(w http.ResponseWriter, status int, form Form) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	formTemplate.Execute(w, form)
+}
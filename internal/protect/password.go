@@ -0,0 +1,166 @@
+// Package protect закрывает ссылки паролем: хранит пароли в виде солёного
+// хеша, ограничивает число попыток ввода и выдаёт подписанные cookie доступа.
+package protect
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	hashScheme = "pbkdf2-sha256"
+	// Iterations — число итераций PBKDF2 для новых хешей (рекомендация OWASP для HMAC-SHA256).
+	Iterations = 600_000
+	saltSize   = 16
+	keySize    = 32
+
+	// MaxPasswordLength ограничивает длину пароля, чтобы хеширование не стало способом нагрузить сервис.
+	MaxPasswordLength = 256
+
+	// MaxHashWait — сколько HashPassword и CheckPassword ждут свободного слота,
+	// прежде чем вернуть ErrBusy.
+	MaxHashWait = 2 * time.Second
+)
+
+var (
+	// ErrPasswordLength — пароль пустой или длиннее MaxPasswordLength.
+	ErrPasswordLength = fmt.Errorf("password must be 1-%d bytes", MaxPasswordLength)
+	// ErrBusy — все слоты хеширования заняты дольше MaxHashWait.
+	ErrBusy = errors.New("too many password checks in progress")
+)
+
+// hashSlots ограничивает число одновременных вычислений PBKDF2. Каждое
+// занимает ядро на сотни миллисекунд, и без ограничения поток запросов с
+// паролями, которые можно слать без входа, отнял бы процессор у редиректов.
+var hashSlots = make(chan struct{}, max(1, runtime.GOMAXPROCS(0)/2))
+
+// acquire занимает слот хеширования. Освобождать его нужно вызовом release.
+func acquire(ctx context.Context) error {
+	timer := time.NewTimer(MaxHashWait)
+	defer timer.Stop()
+	select {
+	case hashSlots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return ErrBusy
+	case <-ctx.Done():
+		return ErrBusy
+	}
+}
+
+func release() {
+	<-hashSlots
+}
+
+// HashPassword возвращает хеш пароля в формате
+// "pbkdf2-sha256$<итерации>$<соль>$<ключ>" (соль и ключ в base64 без выравнивания).
+// Если слот хеширования не освободился за MaxHashWait или раньше отменён ctx,
+// возвращается ErrBusy.
+func HashPassword(ctx context.Context, password string) (string, error) {
+	if password == "" || len(password) > MaxPasswordLength {
+		return "", ErrPasswordLength
+	}
+	if err := acquire(ctx); err != nil {
+		return "", err
+	}
+	defer release()
+	return hashPassword(password, Iterations)
+}
+
+func hashPassword(password string, iterations int) (string, error) {
+	if password == "" || len(password) > MaxPasswordLength {
+		return "", ErrPasswordLength
+	}
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := pbkdf2([]byte(password), salt, iterations, keySize)
+	enc := base64.RawStdEncoding
+	return fmt.Sprintf("%s$%d$%s$%s", hashScheme, iterations, enc.EncodeToString(salt), enc.EncodeToString(key)), nil
+}
+
+// CheckPassword сообщает, соответствует ли password хешу hash.
+// Некорректный hash не подходит ни под один пароль. Как и HashPassword,
+// возвращает ErrBusy, если не дождался слота хеширования.
+func CheckPassword(ctx context.Context, hash, password string) (bool, error) {
+	if len(password) > MaxPasswordLength {
+		return false, nil
+	}
+	iterations, salt, key, err := parseHash(hash)
+	if err != nil {
+		return false, nil
+	}
+	if err := acquire(ctx); err != nil {
+		return false, err
+	}
+	defer release()
+	got := pbkdf2([]byte(password), salt, iterations, len(key))
+	return subtle.ConstantTimeCompare(got, key) == 1, nil
+}
+
+// ValidHash сообщает, что hash имеет формат, который выдаёт HashPassword.
+func ValidHash(hash string) bool {
+	_, _, _, err := parseHash(hash)
+	return err == nil
+}
+
+func parseHash(hash string) (iterations int, salt, key []byte, err error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != hashScheme {
+		return 0, nil, nil, errors.New("unknown password hash format")
+	}
+	iterations, err = strconv.Atoi(parts[1])
+	if err != nil || iterations < 1 {
+		return 0, nil, nil, errors.New("invalid iteration count")
+	}
+	enc := base64.RawStdEncoding
+	if salt, err = enc.DecodeString(parts[2]); err != nil {
+		return 0, nil, nil, err
+	}
+	if key, err = enc.DecodeString(parts[3]); err != nil || len(key) == 0 {
+		return 0, nil, nil, errors.New("invalid key")
+	}
+	return iterations, salt, key, nil
+}
+
+// pbkdf2 реализует PBKDF2 (RFC 8018) с HMAC-SHA256.
+func pbkdf2(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	blocks := (keyLen + hashLen - 1) / hashLen
+
+	var counter [4]byte
+	dk := make([]byte, 0, blocks*hashLen)
+	u := make([]byte, hashLen)
+	for block := 1; block <= blocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(counter[:], uint32(block))
+		prf.Write(counter[:])
+		dk = prf.Sum(dk)
+		t := dk[len(dk)-hashLen:]
+		copy(u, t)
+
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range u {
+				t[j] ^= u[j]
+			}
+		}
+	}
+	return dk[:keyLen]
+}
@@ -0,0 +1,208 @@
+package protect
+
+import (
+	"context"
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPBKDF2(t *testing.T) {
+	// Векторы из RFC 7914, раздел 11
+	tests := []struct {
+		password   string
+		salt       string
+		iterations int
+		want       string
+	}{
+		{
+			password:   "passwd",
+			salt:       "salt",
+			iterations: 1,
+			want:       "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783",
+		},
+		{
+			password:   "Password",
+			salt:       "NaCl",
+			iterations: 80000,
+			want:       "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			got := pbkdf2([]byte(tt.password), []byte(tt.salt), tt.iterations, 64)
+			assert.Equal(t, tt.want, hex.EncodeToString(got))
+		})
+	}
+}
+
+func TestPassword(t *testing.T) {
+	hash, err := hashPassword("s3cret", 1000)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "pbkdf2-sha256$1000$"))
+	assert.True(t, ValidHash(hash))
+
+	other, err := hashPassword("s3cret", 1000)
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, other, "salt must differ")
+
+	tests := []struct {
+		name     string
+		hash     string
+		password string
+		want     bool
+	}{
+		{name: "correct", hash: hash, password: "s3cret", want: true},
+		{name: "wrong", hash: hash, password: "s3cret!"},
+		{name: "empty", hash: hash, password: ""},
+		{name: "too_long", hash: hash, password: strings.Repeat("x", MaxPasswordLength+1)},
+		{name: "bad_scheme", hash: "md5$1$c2FsdA$a2V5", password: "s3cret"},
+		{name: "bad_iterations", hash: "pbkdf2-sha256$0$c2FsdA$a2V5", password: "s3cret"},
+		{name: "empty_hash", hash: "", password: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := CheckPassword(context.Background(), tt.hash, tt.password)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, ok)
+		})
+	}
+
+	_, err = HashPassword(context.Background(), "")
+	assert.ErrorIs(t, err, ErrPasswordLength)
+}
+
+func TestPassword_Busy(t *testing.T) {
+	hash, err := hashPassword("s3cret", 1000)
+	require.NoError(t, err)
+
+	for range cap(hashSlots) {
+		hashSlots <- struct{}{}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = HashPassword(ctx, "s3cret")
+	assert.ErrorIs(t, err, ErrBusy, "no free slot")
+	_, err = CheckPassword(ctx, hash, "s3cret")
+	assert.ErrorIs(t, err, ErrBusy)
+
+	ok, err := CheckPassword(ctx, "md5$1$c2FsdA$a2V5", "s3cret")
+	require.NoError(t, err, "malformed hash needs no slot")
+	assert.False(t, ok)
+
+	release()
+	ok, err = CheckPassword(context.Background(), hash, "s3cret")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	for range cap(hashSlots) - 1 {
+		release()
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	th := NewThrottle(3, time.Minute)
+	th.Now = func() time.Time { return now }
+
+	for range 3 {
+		_, ok := th.Allow("a")
+		require.True(t, ok)
+	}
+	retry, ok := th.Allow("a")
+	assert.False(t, ok)
+	assert.Equal(t, time.Minute, retry)
+
+	_, ok = th.Allow("b")
+	assert.True(t, ok, "other keys are not affected")
+
+	now = now.Add(40 * time.Second)
+	retry, ok = th.Allow("a")
+	assert.False(t, ok)
+	assert.Equal(t, 20*time.Second, retry)
+
+	now = now.Add(20 * time.Second)
+	_, ok = th.Allow("a")
+	assert.True(t, ok, "window expired")
+
+	for range 2 {
+		th.Allow("b")
+	}
+	th.Reset("b")
+	for range 2 {
+		th.Allow("b")
+	}
+	_, ok = th.Allow("b")
+	assert.True(t, ok, "reset clears failures")
+
+	th.Refund("b")
+	_, ok = th.Allow("b")
+	assert.True(t, ok, "refunded attempt is not counted")
+	_, ok = th.Allow("b")
+	assert.False(t, ok)
+}
+
+func TestThrottle_Concurrent(t *testing.T) {
+	th := NewThrottle(5, time.Minute)
+
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for range 100 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, ok := th.Allow("a"); ok {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(5), allowed.Load())
+}
+
+func TestSigner(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s := NewSigner([]byte("key"))
+	value := s.Sign("abc", "hash", now.Add(time.Hour))
+
+	tests := []struct {
+		name   string
+		signer *Signer
+		id     string
+		hash   string
+		value  string
+		now    time.Time
+		want   bool
+	}{
+		{name: "valid", signer: s, id: "abc", hash: "hash", value: value, now: now, want: true},
+		{name: "expired", signer: s, id: "abc", hash: "hash", value: value, now: now.Add(time.Hour)},
+		{name: "other_link", signer: s, id: "abd", hash: "hash", value: value, now: now},
+		{name: "password_changed", signer: s, id: "abc", hash: "hash2", value: value, now: now},
+		{name: "other_key", signer: NewSigner([]byte("other")), id: "abc", hash: "hash", value: value, now: now},
+		{name: "extended", signer: s, id: "abc", hash: "hash", value: "9999999999" + value[strings.Index(value, "."):], now: now},
+		{name: "garbage", signer: s, id: "abc", hash: "hash", value: "garbage", now: now},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.signer.Verify(tt.id, tt.hash, tt.value, tt.now))
+		})
+	}
+}
+
+func TestWriteForm(t *testing.T) {
+	w := httptest.NewRecorder()
+	WriteForm(w, http.StatusUnauthorized, Form{ShortURL: "http://localhost:8080/abc", Action: "/abc?x=<1>", Error: "Wrong password"})
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	body := w.Body.String()
+	assert.Contains(t, body, `action="/abc?x=%3c1%3e"`)
+	assert.Contains(t, body, "Wrong password")
+	assert.Contains(t, body, `type="password"`)
+}
@@ -0,0 +1,95 @@
+package protect
+
+import (
+	"sync"
+	"time"
+)
+
+// Throttle ограничивает число неудачных попыток ввода пароля: после
+// MaxFailures ошибок за Window ключ блокируется до истечения окна. Пока
+// попытка проверяется, она считается неудачной. Nil Throttle не ограничивает
+// попытки.
+type Throttle struct {
+	MaxFailures int
+	Window      time.Duration
+	// Now — источник времени; в тестах подменяется.
+	Now func() time.Time
+
+	mu       sync.Mutex
+	failures map[string]*failures
+}
+
+type failures struct {
+	count int
+	since time.Time
+}
+
+// maxTracked — после стольких ключей устаревшие записи вычищаются.
+const maxTracked = 10_000
+
+// NewThrottle возвращает ограничитель на maxFailures ошибок за window.
+func NewThrottle(maxFailures int, window time.Duration) *Throttle {
+	return &Throttle{
+		MaxFailures: maxFailures,
+		Window:      window,
+		Now:         time.Now,
+		failures:    make(map[string]*failures),
+	}
+}
+
+// Allow резервирует попытку для key: она сразу учитывается как неудачная,
+// а после верного пароля её возвращают через Refund или Reset. Проверка и
+// учёт атомарны, поэтому одновременные попытки не превышают MaxFailures.
+// Если попытка не принята, retryAfter — время до снятия блокировки.
+func (t *Throttle) Allow(key string) (retryAfter time.Duration, ok bool) {
+	if t == nil {
+		return 0, true
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.Now()
+	f, exists := t.failures[key]
+	if !exists || now.Sub(f.since) >= t.Window {
+		if len(t.failures) >= maxTracked {
+			t.purge(now)
+		}
+		t.failures[key] = &failures{count: 1, since: now}
+		return 0, true
+	}
+	if f.count >= t.MaxFailures {
+		return t.Window - now.Sub(f.since), false
+	}
+	f.count++
+	return 0, true
+}
+
+// Refund возвращает попытку, зарезервированную Allow, не трогая ошибки
+// других попыток с тем же key.
+func (t *Throttle) Refund(key string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if f, exists := t.failures[key]; exists && f.count > 0 {
+		f.count--
+	}
+}
+
+// Reset забывает ошибки для key после успешного ввода.
+func (t *Throttle) Reset(key string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.failures, key)
+}
+
+func (t *Throttle) purge(now time.Time) {
+	for key, f := range t.failures {
+		if now.Sub(f.since) >= t.Window {
+			delete(t.failures, key)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package qr
+
+// bitBuffer накапливает биты от старших к младшим.
+type bitBuffer struct {
+	bits []bool
+}
+
+func (b *bitBuffer) append(val, n int) {
+	for i := n - 1; i >= 0; i-- {
+		b.bits = append(b.bits, val>>i&1 != 0)
+	}
+}
+
+func (b *bitBuffer) len() int {
+	return len(b.bits)
+}
+
+func (b *bitBuffer) bytes() []byte {
+	out := make([]byte, (len(b.bits)+7)/8)
+	for i, set := range b.bits {
+		if set {
+			out[i>>3] |= 0x80 >> (i & 7)
+		}
+	}
+	return out
+}
@@ -0,0 +1,96 @@
+package qr
+
+// Веса правил штрафа из ISO/IEC 18004, раздел 7.8.3.
+const (
+	penaltyN1 = 3
+	penaltyN2 = 3
+	penaltyN3 = 40
+	penaltyN4 = 10
+)
+
+// finderLike — узор 1:1:3:1:1, похожий на поисковый.
+var finderLike = []bool{true, false, true, true, true, false, true}
+
+// penalty оценивает, насколько матрица неудобна для сканеров: длинные
+// одноцветные серии, одноцветные квадраты 2×2, ложные поисковые узоры и
+// перекос доли тёмных модулей.
+func (c *Code) penalty() int {
+	p := 0
+	line := make([]bool, c.Size)
+	for i := 0; i < c.Size; i++ {
+		for j := 0; j < c.Size; j++ {
+			line[j] = c.modules[i][j]
+		}
+		p += linePenalty(line)
+		for j := 0; j < c.Size; j++ {
+			line[j] = c.modules[j][i]
+		}
+		p += linePenalty(line)
+	}
+
+	dark := 0
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.modules[y][x] {
+				dark++
+			}
+			if x+1 < c.Size && y+1 < c.Size {
+				m := c.modules[y][x]
+				if m == c.modules[y][x+1] && m == c.modules[y+1][x] && m == c.modules[y+1][x+1] {
+					p += penaltyN2
+				}
+			}
+		}
+	}
+
+	// k — на сколько полных шагов по 5% доля тёмных модулей отклоняется от 50%
+	total := c.Size * c.Size
+	k := abs(dark*20-total*10) / total
+	return p + k*penaltyN4
+}
+
+// linePenalty считает правила N1 и N3 для одной строки или столбца.
+func linePenalty(line []bool) int {
+	p := 0
+	run := 1
+	for i := 1; i <= len(line); i++ {
+		if i < len(line) && line[i] == line[i-1] {
+			run++
+			continue
+		}
+		if run >= 5 {
+			p += penaltyN1 + run - 5
+		}
+		run = 1
+	}
+
+	// За краем матрицы — светлая зона тишины. Узор штрафуется один раз,
+	// если светлые 4 модуля есть перед ним или после него
+	padded := make([]bool, len(line)+8)
+	copy(padded[4:], line)
+	for i := 4; i+len(finderLike) <= len(line)+4; i++ {
+		if equal(padded[i:i+len(finderLike)], finderLike) &&
+			(light(padded[i-4:i]) || light(padded[i+len(finderLike):i+len(finderLike)+4])) {
+			p += penaltyN3
+		}
+	}
+	return p
+}
+
+func equal(a, b []bool) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func light(modules []bool) bool {
+	for _, m := range modules {
+		if m {
+			return false
+		}
+	}
+	return true
+}
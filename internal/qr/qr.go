@@ -0,0 +1,366 @@
+// Package qr кодирует данные в QR-код (ISO/IEC 18004) в байтовом режиме.
+package qr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Level — уровень коррекции ошибок.
+type Level int
+
+const (
+	Low      Level = iota // восстанавливается ~7% кода
+	Medium                // ~15%
+	Quartile              // ~25%
+	High                  // ~30%
+)
+
+// formatBits — код уровня коррекции в информации о формате.
+var formatBits = [4]int{Low: 1, Medium: 0, Quartile: 3, High: 2}
+
+// ParseLevel разбирает уровень коррекции по букве L, M, Q или H.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToUpper(s) {
+	case "L":
+		return Low, nil
+	case "M":
+		return Medium, nil
+	case "Q":
+		return Quartile, nil
+	case "H":
+		return High, nil
+	}
+	return 0, fmt.Errorf("unknown error correction level %q", s)
+}
+
+func (l Level) String() string {
+	return [...]string{"L", "M", "Q", "H"}[l]
+}
+
+// ErrTooLong возвращается, если данные не помещаются даже в версию 40.
+var ErrTooLong = errors.New("data too long for a QR code")
+
+const (
+	minVersion = 1
+	maxVersion = 40
+)
+
+// Code — матрица модулей QR-кода без зоны тишины.
+type Code struct {
+	Version int
+	Level   Level
+	Mask    int
+	Size    int
+
+	modules    [][]bool
+	isFunction [][]bool
+}
+
+// Black сообщает, тёмный ли модуль в столбце x и строке y.
+func (c *Code) Black(x, y int) bool {
+	return c.modules[y][x]
+}
+
+// Encode кодирует data в QR-код минимальной подходящей версии с уровнем коррекции level.
+func Encode(data []byte, level Level) (*Code, error) {
+	if level < Low || level > High {
+		return nil, fmt.Errorf("unknown error correction level %d", level)
+	}
+	version := minVersion
+	for ; ; version++ {
+		if version > maxVersion {
+			return nil, ErrTooLong
+		}
+		if segmentBits(version, len(data)) <= dataCodewords(version, level)*8 {
+			break
+		}
+	}
+
+	c := newCode(version, level)
+	c.drawCodewords(c.addECC(c.dataCodewords(data)))
+	c.chooseMask()
+	return c, nil
+}
+
+// countBits возвращает длину поля количества символов байтового режима.
+func countBits(version int) int {
+	if version <= 9 {
+		return 8
+	}
+	return 16
+}
+
+func segmentBits(version, n int) int {
+	if n >= 1<<countBits(version) {
+		return int(^uint(0) >> 1)
+	}
+	return 4 + countBits(version) + 8*n
+}
+
+// newCode создаёт матрицу версии version с нарисованными служебными узорами.
+func newCode(version int, level Level) *Code {
+	size := version*4 + 17
+	c := &Code{
+		Version:    version,
+		Level:      level,
+		Size:       size,
+		modules:    make([][]bool, size),
+		isFunction: make([][]bool, size),
+	}
+	for i := range c.modules {
+		c.modules[i] = make([]bool, size)
+		c.isFunction[i] = make([]bool, size)
+	}
+	c.drawFunctionPatterns()
+	return c
+}
+
+func (c *Code) setFunction(x, y int, black bool) {
+	c.modules[y][x] = black
+	c.isFunction[y][x] = true
+}
+
+func (c *Code) drawFunctionPatterns() {
+	for i := 0; i < c.Size; i++ {
+		c.setFunction(6, i, i%2 == 0)
+		c.setFunction(i, 6, i%2 == 0)
+	}
+
+	c.drawFinder(3, 3)
+	c.drawFinder(c.Size-4, 3)
+	c.drawFinder(3, c.Size-4)
+
+	positions := alignmentPositions(c.Version)
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			// Углы заняты поисковыми узорами
+			if i == 0 && j == 0 || i == 0 && j == last || i == last && j == 0 {
+				continue
+			}
+			c.drawAlignment(x, y)
+		}
+	}
+
+	// Резервируем место под формат; настоящие значения появятся после выбора маски
+	c.drawFormat(0)
+	c.drawVersion()
+}
+
+// drawFinder рисует поисковый узор с разделителем вокруг центра (x, y).
+func (c *Code) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || xx >= c.Size || yy < 0 || yy >= c.Size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			c.setFunction(xx, yy, dist != 2 && dist != 4)
+		}
+	}
+}
+
+func (c *Code) drawAlignment(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			c.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// formatInfo возвращает 15 бит информации о формате с кодом БЧХ и маской XOR.
+func formatInfo(level Level, mask int) int {
+	data := formatBits[level]<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+// versionInfo возвращает 18 бит информации о версии с кодом БЧХ.
+func versionInfo(version int) int {
+	rem := version
+	for i := 0; i < 12; i++ {
+		rem = rem<<1 ^ (rem>>11)*0x1F25
+	}
+	return version<<12 | rem
+}
+
+func bit(x, i int) bool {
+	return x>>i&1 != 0
+}
+
+func (c *Code) drawFormat(mask int) {
+	bits := formatInfo(c.Level, mask)
+
+	// Копия у левого верхнего поискового узора
+	for i := 0; i <= 5; i++ {
+		c.setFunction(8, i, bit(bits, i))
+	}
+	c.setFunction(8, 7, bit(bits, 6))
+	c.setFunction(8, 8, bit(bits, 7))
+	c.setFunction(7, 8, bit(bits, 8))
+	for i := 9; i < 15; i++ {
+		c.setFunction(14-i, 8, bit(bits, i))
+	}
+
+	// Копия у двух других поисковых узоров
+	for i := 0; i < 8; i++ {
+		c.setFunction(c.Size-1-i, 8, bit(bits, i))
+	}
+	for i := 8; i < 15; i++ {
+		c.setFunction(8, c.Size-15+i, bit(bits, i))
+	}
+	c.setFunction(8, c.Size-8, true)
+}
+
+func (c *Code) drawVersion() {
+	if c.Version < 7 {
+		return
+	}
+	bits := versionInfo(c.Version)
+	for i := 0; i < 18; i++ {
+		a, b := c.Size-11+i%3, i/3
+		c.setFunction(a, b, bit(bits, i))
+		c.setFunction(b, a, bit(bits, i))
+	}
+}
+
+// dataCodewords строит поток данных: сегмент байтового режима, терминатор и заполнение.
+func (c *Code) dataCodewords(data []byte) []byte {
+	capacity := dataCodewords(c.Version, c.Level)
+	var bb bitBuffer
+	bb.append(0b0100, 4)
+	bb.append(len(data), countBits(c.Version))
+	for _, b := range data {
+		bb.append(int(b), 8)
+	}
+	bb.append(0, min(4, capacity*8-bb.len()))
+	bb.append(0, (8-bb.len()%8)%8)
+
+	out := bb.bytes()
+	for pad := byte(0xEC); len(out) < capacity; pad ^= 0xEC ^ 0x11 {
+		out = append(out, pad)
+	}
+	return out
+}
+
+// addECC делит данные на блоки, дописывает к каждому коды коррекции и
+// перемежает блоки в итоговую последовательность.
+func (c *Code) addECC(data []byte) []byte {
+	numBlocks := eccBlocks[c.Level][c.Version]
+	eccLen := eccCodewordsPerBlock[c.Level][c.Version]
+	raw := rawDataModules(c.Version) / 8
+	numShort := numBlocks - raw%numBlocks
+	shortLen := raw / numBlocks
+
+	divisor := rsDivisor(eccLen)
+	blocks := make([][]byte, numBlocks)
+	for i, k := 0, 0; i < numBlocks; i++ {
+		n := shortLen - eccLen
+		if i >= numShort {
+			n++
+		}
+		block := append([]byte(nil), data[k:k+n]...)
+		k += n
+		ecc := rsRemainder(block, divisor)
+		if i < numShort {
+			// Выравниваем длину с длинными блоками; при перемежении байт пропускается
+			block = append(block, 0)
+		}
+		blocks[i] = append(block, ecc...)
+	}
+
+	out := make([]byte, 0, raw)
+	for i := range blocks[0] {
+		for j, block := range blocks {
+			if i != shortLen-eccLen || j >= numShort {
+				out = append(out, block[i])
+			}
+		}
+	}
+	return out
+}
+
+// zigzag вызывает fn для модулей данных в порядке их заполнения: парами столбцов
+// справа налево, змейкой вверх и вниз.
+func (c *Code) zigzag(fn func(x, y int)) {
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < c.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = c.Size - 1 - vert
+				}
+				if !c.isFunction[y][x] {
+					fn(x, y)
+				}
+			}
+		}
+	}
+}
+
+func (c *Code) drawCodewords(data []byte) {
+	i := 0
+	c.zigzag(func(x, y int) {
+		// Оставшиеся биты (0–7 штук) остаются светлыми
+		if i < len(data)*8 {
+			c.modules[y][x] = data[i>>3]>>(7-i&7)&1 != 0
+			i++
+		}
+	})
+}
+
+// maskFuncs — условия инверсии модуля для масок 0–7.
+var maskFuncs = [8]func(x, y int) bool{
+	func(x, y int) bool { return (x+y)%2 == 0 },
+	func(x, y int) bool { return y%2 == 0 },
+	func(x, y int) bool { return x%3 == 0 },
+	func(x, y int) bool { return (x+y)%3 == 0 },
+	func(x, y int) bool { return (x/3+y/2)%2 == 0 },
+	func(x, y int) bool { return x*y%2+x*y%3 == 0 },
+	func(x, y int) bool { return (x*y%2+x*y%3)%2 == 0 },
+	func(x, y int) bool { return ((x+y)%2+x*y%3)%2 == 0 },
+}
+
+// applyMask инвертирует модули данных по маске; повторный вызов отменяет её.
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.isFunction[y][x] && maskFuncs[mask](x, y) {
+				c.modules[y][x] = !c.modules[y][x]
+			}
+		}
+	}
+}
+
+// chooseMask применяет маску с наименьшим штрафом.
+func (c *Code) chooseMask() {
+	best, bestPenalty := 0, -1
+	for mask := range maskFuncs {
+		c.applyMask(mask)
+		c.drawFormat(mask)
+		if p := c.penalty(); bestPenalty < 0 || p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+		c.applyMask(mask)
+	}
+	c.Mask = best
+	c.applyMask(best)
+	c.drawFormat(best)
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,257 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"image/png"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRSRemainder(t *testing.T) {
+	// Пример «HELLO WORLD», версия 1-M
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	assert.Equal(t, want, rsRemainder(data, rsDivisor(len(want))))
+}
+
+func TestTables(t *testing.T) {
+	assert.Equal(t, 0b111011111000100, formatInfo(Low, 0))
+	assert.Equal(t, 0b111001011110011, formatInfo(Low, 1))
+	assert.Equal(t, 0b101010000010010, formatInfo(Medium, 0))
+	assert.Equal(t, 0b000100000111011, formatInfo(High, 7))
+	assert.Equal(t, 0b000111110010010100, versionInfo(7))
+
+	assert.Equal(t, 16, dataCodewords(1, Medium))
+	assert.Equal(t, 156, dataCodewords(7, Low))
+	assert.Equal(t, 2956, dataCodewords(40, Low))
+	assert.Equal(t, 1276, dataCodewords(40, High))
+
+	assert.Nil(t, alignmentPositions(1))
+	assert.Equal(t, []int{6, 22, 38}, alignmentPositions(7))
+	assert.Equal(t, []int{6, 34, 60, 86, 112, 138}, alignmentPositions(32))
+	assert.Equal(t, []int{6, 30, 58, 86, 114, 142, 170}, alignmentPositions(40))
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, s := range []string{"L", "m", "Q", "h"} {
+		level, err := ParseLevel(s)
+		require.NoError(t, err)
+		assert.Equal(t, strings.ToUpper(s), level.String())
+	}
+	_, err := ParseLevel("X")
+	assert.Error(t, err)
+}
+
+// fixture — эталонная матрица из testdata, построенная другим кодировщиком.
+type fixture struct {
+	source  string
+	data    string
+	level   Level
+	version int
+	mask    int
+	modules [][]bool
+}
+
+// readFixture читает файл вида «ключ: значение», пустая строка, затем строки
+// матрицы: «#» — тёмный модуль, «.» — светлый.
+func readFixture(t *testing.T, path string) fixture {
+	t.Helper()
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	header, grid, ok := strings.Cut(string(raw), "\n\n")
+	require.True(t, ok, "%s: no blank line after header", path)
+
+	var f fixture
+	for _, line := range strings.Split(header, "\n") {
+		key, value, _ := strings.Cut(line, ": ")
+		switch key {
+		case "source":
+			f.source = value
+		case "data":
+			f.data = value
+		case "level":
+			f.level, err = ParseLevel(value)
+		case "version":
+			f.version, err = strconv.Atoi(value)
+		case "mask":
+			f.mask, err = strconv.Atoi(value)
+		default:
+			t.Fatalf("%s: unknown key %q", path, key)
+		}
+		require.NoError(t, err, "%s: %s", path, line)
+	}
+	for _, row := range strings.Fields(grid) {
+		modules := make([]bool, len(row))
+		for x, m := range row {
+			modules[x] = m == '#'
+		}
+		f.modules = append(f.modules, modules)
+	}
+	return f
+}
+
+// assertModules сравнивает матрицу кода с эталонной побитно.
+func assertModules(t *testing.T, want [][]bool, c *Code) {
+	t.Helper()
+	require.Len(t, want, c.Size)
+	var diff []string
+	for y := range want {
+		for x := range want[y] {
+			if want[y][x] != c.Black(x, y) {
+				diff = append(diff, fmt.Sprintf("(%d,%d)", x, y))
+			}
+		}
+	}
+	assert.Empty(t, diff, "modules differ from the reference")
+}
+
+// TestEncode_Reference сверяет весь путь кодирования, включая выбор версии и
+// маски по штрафам, с выводом zxing.
+func TestEncode_Reference(t *testing.T) {
+	paths, err := filepath.Glob("testdata/encode/*.txt")
+	require.NoError(t, err)
+	require.NotEmpty(t, paths)
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			f := readFixture(t, path)
+			c, err := Encode([]byte(f.data), f.level)
+			require.NoError(t, err)
+			assert.Equal(t, f.version, c.Version)
+			assert.Equal(t, f.mask, c.Mask, "mask chosen by %s", f.source)
+			assertModules(t, f.modules, c)
+		})
+	}
+}
+
+// TestEncode_Masks сверяет матрицы с каждой из масок с выводом rsc.io/qr, где
+// маска задаётся явно: так проверяются данные, коррекция ошибок и служебные
+// поля независимо от выбора маски.
+func TestEncode_Masks(t *testing.T) {
+	paths, err := filepath.Glob("testdata/mask/*.txt")
+	require.NoError(t, err)
+	require.NotEmpty(t, paths)
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			f := readFixture(t, path)
+			c, err := Encode([]byte(f.data), f.level)
+			require.NoError(t, err)
+			require.Equal(t, f.version, c.Version)
+
+			c.applyMask(c.Mask)
+			c.applyMask(f.mask)
+			c.drawFormat(f.mask)
+			assertModules(t, f.modules, c)
+		})
+	}
+}
+
+func TestEncode_Errors(t *testing.T) {
+	_, err := Encode(bytes.Repeat([]byte("x"), 2954), Low)
+	assert.ErrorIs(t, err, ErrTooLong)
+
+	_, err = Encode([]byte("x"), Level(7))
+	assert.Error(t, err)
+}
+
+func TestImage_Size(t *testing.T) {
+	c, err := Encode([]byte("http://localhost:8080/abc"), Medium)
+	require.NoError(t, err)
+
+	// 25 модулей + 2×4 зоны тишины = 33; 256/33 = 7 пикселей на модуль
+	assert.Equal(t, 231, c.Image(256, QuietZone).Bounds().Dx())
+	assert.Equal(t, 33, c.Image(10, QuietZone).Bounds().Dx(), "module is at least one pixel")
+}
+
+func TestRender(t *testing.T) {
+	f := readFixture(t, "testdata/encode/short_M.txt")
+	c, err := Encode([]byte(f.data), f.level)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, c.WritePNG(&buf, 256, QuietZone))
+	grid, err := pngModules(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, f.modules, grid)
+
+	buf.Reset()
+	require.NoError(t, c.WriteSVG(&buf, 256, QuietZone))
+	grid, err = svgModules(buf.String())
+	require.NoError(t, err)
+	assert.Equal(t, f.modules, grid)
+}
+
+// pngModules восстанавливает матрицу по изображению: левый верхний поисковый
+// узор задаёт зону тишины и размер модуля.
+func pngModules(r *bytes.Buffer) ([][]bool, error) {
+	img, err := png.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	dark := func(x, y int) bool {
+		r, g, b, _ := img.At(x, y).RGBA()
+		return r+g+b < 3*0x8000
+	}
+	width := img.Bounds().Dx()
+
+	offset := 0
+	for ; offset < width && !dark(offset, offset); offset++ {
+	}
+	run := 0
+	for dark(offset+run, offset) {
+		run++
+	}
+	scale := run / 7
+	if scale == 0 {
+		return nil, errors.New("finder pattern not found")
+	}
+
+	size := (width - 2*offset) / scale
+	grid := make([][]bool, size)
+	for y := range grid {
+		grid[y] = make([]bool, size)
+		for x := range grid[y] {
+			grid[y][x] = dark(offset+x*scale+scale/2, offset+y*scale+scale/2)
+		}
+	}
+	return grid, nil
+}
+
+var (
+	svgViewBox = regexp.MustCompile(`viewBox="0 0 (\d+) (\d+)"`)
+	svgModule  = regexp.MustCompile(`M(\d+) (\d+)h1v1h-1z`)
+)
+
+func svgModules(svg string) ([][]bool, error) {
+	m := svgViewBox.FindStringSubmatch(svg)
+	if m == nil {
+		return nil, errors.New("no viewBox")
+	}
+	side, _ := strconv.Atoi(m[1])
+
+	var points [][2]int
+	quiet := side
+	for _, m := range svgModule.FindAllStringSubmatch(svg, -1) {
+		x, _ := strconv.Atoi(m[1])
+		y, _ := strconv.Atoi(m[2])
+		points = append(points, [2]int{x, y})
+		quiet = min(quiet, x, y)
+	}
+
+	size := side - 2*quiet
+	grid := make([][]bool, size)
+	for y := range grid {
+		grid[y] = make([]bool, size)
+	}
+	for _, p := range points {
+		grid[p[1]-quiet][p[0]-quiet] = true
+	}
+	return grid, nil
+}
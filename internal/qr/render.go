@@ -0,0 +1,67 @@
+package qr
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+)
+
+// QuietZone — ширина светлой рамки вокруг кода в модулях, требуемая стандартом.
+const QuietZone = 4
+
+// scale возвращает размер модуля в пикселях, при котором код с зоной тишины
+// quiet укладывается в size пикселей, но не меньше одного пикселя.
+func (c *Code) scale(size, quiet int) int {
+	return max(1, size/(c.Size+2*quiet))
+}
+
+// Image возвращает изображение кода шириной не больше size пикселей (если
+// size не меньше числа модулей) с зоной тишины quiet модулей.
+func (c *Code) Image(size, quiet int) image.Image {
+	scale := c.scale(size, quiet)
+	side := (c.Size + 2*quiet) * scale
+	img := image.NewPaletted(image.Rect(0, 0, side, side), color.Palette{color.White, color.Black})
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.modules[y][x] {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				row := (quiet+y)*scale + dy
+				for dx := 0; dx < scale; dx++ {
+					img.SetColorIndex((quiet+x)*scale+dx, row, 1)
+				}
+			}
+		}
+	}
+	return img
+}
+
+// WritePNG записывает код в формате PNG, см. Image.
+func (c *Code) WritePNG(w io.Writer, size, quiet int) error {
+	return png.Encode(w, c.Image(size, quiet))
+}
+
+// WriteSVG записывает код в формате SVG со стороной size пикселей.
+// Каждый тёмный модуль — квадрат 1×1 в системе координат модулей.
+func (c *Code) WriteSVG(w io.Writer, size, quiet int) error {
+	side := c.Size + 2*quiet
+	var path strings.Builder
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.modules[y][x] {
+				fmt.Fprintf(&path, "M%d %dh1v1h-1z", quiet+x, quiet+y)
+			}
+		}
+	}
+	_, err := fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" version="1.1" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">
+<rect width="100%%" height="100%%" fill="#ffffff"/>
+<path d="%s" fill="#000000"/>
+</svg>
+`, size, size, side, side, path.String())
+	return err
+}
@@ -0,0 +1,67 @@
+package schedule
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// PageData — данные, доступные в шаблоне страницы.
+type PageData struct {
+	ShortURL   string
+	ActiveFrom time.Time
+}
+
+// Page — ответ на переход по ссылке, которая ещё не начала действовать:
+// HTML-шаблон из файла или, если он не задан, обычный 404. Шаблон можно
+// заменить на лету.
+type Page struct {
+	tmpl atomic.Pointer[template.Template]
+}
+
+// NewPage загружает шаблон из path. Пустой path означает ответ 404 без страницы.
+func NewPage(path string) (*Page, error) {
+	p := &Page{}
+	if err := p.Reload(path); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Reload перечитывает шаблон из path. При ошибке остаётся прежний шаблон.
+func (p *Page) Reload(path string) error {
+	if path == "" {
+		p.tmpl.Store(nil)
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("schedule: %w", err)
+	}
+	tmpl, err := template.New("inactive").Parse(string(data))
+	if err != nil {
+		return fmt.Errorf("schedule: %w", err)
+	}
+	p.tmpl.Store(tmpl)
+	return nil
+}
+
+// Write отвечает кодом 404 и страницей из шаблона, если он задан.
+// Ответ не кэшируется, чтобы ссылка заработала ровно в назначенное время.
+func (p *Page) Write(w http.ResponseWriter, data PageData) {
+	w.Header().Set("Cache-Control", "no-store")
+	var tmpl *template.Template
+	if p != nil {
+		tmpl = p.tmpl.Load()
+	}
+	if tmpl == nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusNotFound)
+	tmpl.Execute(w, data)
+}
@@ -0,0 +1,29 @@
+// Package schedule определяет, действует ли ссылка в данный момент, и
+// показывает страницу для ссылок, которые ещё не начали действовать.
+package schedule
+
+import "time"
+
+// State — состояние ссылки относительно окна действия.
+type State int
+
+const (
+	// Active — ссылка действует.
+	Active State = iota
+	// Pending — ссылка ещё не начала действовать.
+	Pending
+	// Expired — ссылка уже перестала действовать.
+	Expired
+)
+
+// Of возвращает состояние окна [from, until) на момент now.
+// nil означает, что граница не задана.
+func Of(from, until *time.Time, now time.Time) State {
+	if from != nil && now.Before(*from) {
+		return Pending
+	}
+	if until != nil && !now.Before(*until) {
+		return Expired
+	}
+	return Active
+}
@@ -0,0 +1,79 @@
+package schedule
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOf(t *testing.T) {
+	from := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	until := time.Date(2024, 6, 2, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		from  *time.Time
+		until *time.Time
+		now   time.Time
+		want  State
+	}{
+		{name: "unbounded", now: from, want: Active},
+		{name: "before_from", from: &from, until: &until, now: from.Add(-time.Second), want: Pending},
+		{name: "at_from", from: &from, until: &until, now: from, want: Active},
+		{name: "inside", from: &from, until: &until, now: from.Add(time.Hour), want: Active},
+		{name: "at_until", from: &from, until: &until, now: until, want: Expired},
+		{name: "only_until", until: &until, now: from, want: Active},
+		{name: "only_from", from: &from, now: until, want: Active},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Of(tt.from, tt.until, tt.now))
+		})
+	}
+}
+
+func TestPage(t *testing.T) {
+	data := PageData{ShortURL: "http://localhost:8080/launch", ActiveFrom: time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)}
+
+	t.Run("default", func(t *testing.T) {
+		page, err := NewPage("")
+		require.NoError(t, err)
+		w := httptest.NewRecorder()
+		page.Write(w, data)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+		assert.Equal(t, "Not Found\n", w.Body.String())
+	})
+
+	t.Run("custom", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "soon.html")
+		require.NoError(t, os.WriteFile(path, []byte(`<p>{{.ShortURL}} opens {{.ActiveFrom.Format "2006-01-02 15:04"}}</p>`), 0644))
+		page, err := NewPage(path)
+		require.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		page.Write(w, data)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.Equal(t, "<p>http://localhost:8080/launch opens 2024-06-01 10:00</p>", w.Body.String())
+
+		require.NoError(t, os.WriteFile(path, []byte(`{{.Broken`), 0644))
+		assert.Error(t, page.Reload(path))
+		w = httptest.NewRecorder()
+		page.Write(w, data)
+		assert.Contains(t, w.Body.String(), "opens", "previous template is kept")
+
+		assert.Error(t, page.Reload(filepath.Join(t.TempDir(), "missing.html")))
+	})
+
+	t.Run("nil", func(t *testing.T) {
+		var page *Page
+		w := httptest.NewRecorder()
+		page.Write(w, data)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
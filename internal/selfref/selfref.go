@@ -0,0 +1,145 @@
+package selfref
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// MaxHops ограничивает длину цепочки наших ссылок, которую Guard готов разворачивать.
+const MaxHops = 10
+
+// Error описывает, почему адрес назначения отклонён.
+type Error struct {
+	Reason string
+}
+
+func (e *Error) Error() string {
+	return e.Reason
+}
+
+var (
+	errSelfReference = &Error{Reason: "destination points to this shortener"}
+	errLoop          = &Error{Reason: "destination creates a redirect loop"}
+	errTooLong       = &Error{Reason: fmt.Sprintf("destination is a chain of more than %d short links", MaxHops)}
+)
+
+// ErrNotFound должна возвращать Lookup, если короткой ссылки нет.
+var ErrNotFound = errors.New("short link not found")
+
+// Lookup возвращает адрес назначения короткой ссылки id.
+type Lookup func(ctx context.Context, id string) (string, error)
+
+// Guard не даёт сокращать адреса, ведущие обратно на наш сервис.
+type Guard struct {
+	hosts    map[string]bool
+	basePath string
+	flatten  bool
+	lookup   Lookup
+}
+
+// New создаёт Guard. baseURL — базовый адрес коротких ссылок, otherHosts —
+// дополнительные домены (host[:port]), которые тоже обслуживает сервис.
+// Если flatten включён, цепочки наших ссылок заменяются конечным адресом.
+func New(baseURL string, otherHosts []string, flatten bool, lookup Lookup) (*Guard, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	g := &Guard{
+		hosts:    make(map[string]bool, len(otherHosts)+1),
+		basePath: "/" + strings.Trim(base.Path, "/"),
+		flatten:  flatten,
+		lookup:   lookup,
+	}
+	g.hosts[canonicalHost(base.Scheme, base.Host)] = true
+	// Схема дополнительных доменов неизвестна, поэтому порт по умолчанию
+	// отбрасывается для обеих
+	for _, h := range otherHosts {
+		g.hosts[canonicalHost("http", h)] = true
+		g.hosts[canonicalHost("https", h)] = true
+	}
+	return g, nil
+}
+
+// canonicalHost приводит host к виду, который выдаёт нормализатор URL.
+func canonicalHost(scheme, host string) string {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	switch {
+	case scheme == "http" && strings.HasSuffix(host, ":80"):
+		host = strings.TrimSuffix(host, ":80")
+	case scheme == "https" && strings.HasSuffix(host, ":443"):
+		host = strings.TrimSuffix(host, ":443")
+	}
+	return host
+}
+
+// shortID возвращает идентификатор, если u — наша короткая ссылка.
+// ok == false означает, что адрес чужой; пустой id при ok == true — что адрес
+// ведёт на наш сервис, но не на короткую ссылку.
+func (g *Guard) shortID(u *url.URL) (id string, ours bool) {
+	if !g.hosts[canonicalHost(u.Scheme, u.Host)] {
+		return "", false
+	}
+	rest := strings.TrimPrefix(u.Path, g.basePath)
+	if rest == u.Path && g.basePath != "/" {
+		return "", true
+	}
+	rest = strings.Trim(rest, "/")
+	if rest == "" || strings.Contains(rest, "/") {
+		return "", true
+	}
+	return rest, true
+}
+
+// Resolve проверяет адрес назначения новой ссылки newID. Если адрес чужой,
+// он возвращается без изменений. Если он ведёт на наш сервис, Resolve
+// отклоняет его с *Error или, при включённом flatten, возвращает конечный адрес цепочки.
+func (g *Guard) Resolve(ctx context.Context, newID, destination string) (string, error) {
+	final, hops, err := g.follow(ctx, newID, destination)
+	if err != nil {
+		return "", err
+	}
+	if hops > 0 && !g.flatten {
+		return "", errSelfReference
+	}
+	return final, nil
+}
+
+// follow проходит цепочку наших коротких ссылок до первого чужого адреса.
+// Цепочка проходится до конца даже без flatten, чтобы сообщить о петле, если она есть.
+func (g *Guard) follow(ctx context.Context, newID, destination string) (string, int, error) {
+	visited := map[string]bool{newID: true}
+	current := destination
+
+	for hops := 0; ; hops++ {
+		u, err := url.Parse(current)
+		if err != nil {
+			return "", hops, err
+		}
+		id, ours := g.shortID(u)
+		if !ours {
+			return current, hops, nil
+		}
+		if id == "" {
+			return "", hops, errSelfReference
+		}
+		if visited[id] {
+			return "", hops, errLoop
+		}
+		if hops >= MaxHops {
+			return "", hops, errTooLong
+		}
+		visited[id] = true
+
+		current, err = g.lookup(ctx, id)
+		if errors.Is(err, ErrNotFound) {
+			return "", hops, &Error{Reason: fmt.Sprintf("destination points to unknown short link %q", id)}
+		}
+		if err != nil {
+			return "", hops, err
+		}
+	}
+}
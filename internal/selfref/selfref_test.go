@@ -0,0 +1,112 @@
+package selfref
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func mapLookup(links map[string]string) Lookup {
+	return func(_ context.Context, id string) (string, error) {
+		if dst, ok := links[id]; ok {
+			return dst, nil
+		}
+		return "", ErrNotFound
+	}
+}
+
+func TestGuard_Resolve(t *testing.T) {
+	links := map[string]string{
+		"aaa": "https://example.com/final",
+		"bbb": "http://localhost:8080/aaa",
+		"ccc": "http://localhost:8080/ddd",
+		"ddd": "http://localhost:8080/ccc",
+		"eee": "http://localhost:8080/new",
+	}
+	tests := []struct {
+		name        string
+		flatten     bool
+		destination string
+		want        string
+		wantErr     string
+	}{
+		{
+			name:        "external",
+			destination: "https://example.com/page",
+			want:        "https://example.com/page",
+		},
+		{
+			name:        "self_not_a_link",
+			flatten:     true,
+			destination: "http://localhost:8080/api/shorten",
+			wantErr:     "points to this shortener",
+		},
+		{
+			name:        "unknown_link",
+			destination: "http://localhost:8080/zzz",
+			wantErr:     `unknown short link "zzz"`,
+		},
+		{
+			name:        "chain_rejected",
+			destination: "http://localhost:8080/aaa",
+			wantErr:     "points to this shortener",
+		},
+		{
+			name:        "chain_flattened",
+			flatten:     true,
+			destination: "http://localhost:8080/bbb",
+			want:        "https://example.com/final",
+		},
+		{
+			name:        "other_own_domain",
+			flatten:     true,
+			destination: "https://sho.rt/aaa",
+			want:        "https://example.com/final",
+		},
+		{
+			name:        "loop",
+			flatten:     true,
+			destination: "http://localhost:8080/ccc",
+			wantErr:     "redirect loop",
+		},
+		{
+			name:        "loop_through_new_link",
+			destination: "http://localhost:8080/eee",
+			wantErr:     "redirect loop",
+		},
+		{
+			name:        "self",
+			destination: "http://localhost:8080/new",
+			wantErr:     "redirect loop",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := New("http://localhost:8080/", []string{"SHO.RT:443"}, tt.flatten, mapLookup(links))
+			require.NoError(t, err)
+
+			got, err := g.Resolve(context.Background(), "new", tt.destination)
+			if tt.wantErr != "" {
+				var serr *Error
+				require.ErrorAs(t, err, &serr)
+				assert.Contains(t, serr.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestGuard_ResolveTooLong(t *testing.T) {
+	links := make(map[string]string)
+	for i := 0; i <= MaxHops; i++ {
+		links[string(rune('a'+i))] = "https://s.example/" + string(rune('a'+i+1))
+	}
+	g, err := New("https://s.example/", nil, true, mapLookup(links))
+	require.NoError(t, err)
+
+	_, err = g.Resolve(context.Background(), "new", "https://s.example/a")
+	assert.ErrorContains(t, err, "chain of more than")
+}
@@ -2,13 +2,29 @@ package storage
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
+	"github.com/ivanlp-p/ShortLinkService/internal/metrics"
 	"github.com/ivanlp-p/ShortLinkService/internal/models"
+	"github.com/ivanlp-p/ShortLinkService/internal/tracing"
 	"os"
 	"sync"
+	"time"
 )
 
+// ErrNotFound возвращается, если короткой ссылки нет в хранилище.
+var ErrNotFound = errors.New("original URL not found")
+
+// ErrClickLimit возвращается, если ссылка уже использована MaxClicks раз.
+var ErrClickLimit = errors.New("click limit reached")
+
+// ErrLinkExists возвращается при создании ссылки с уже занятым идентификатором.
+var ErrLinkExists = errors.New("short link already exists")
+
+// ErrVersionConflict возвращается, если ссылку изменили после того, как её прочитал клиент.
+var ErrVersionConflict = errors.New("link version conflict")
+
 type FileStorage struct {
 	fileName string
 	store    *MapStorage
@@ -22,9 +38,14 @@ func NewFileStorage(fileName string, store *MapStorage) *FileStorage {
 	}
 }
 
-func (fs *FileStorage) LoadFromFile() error {
+func (fs *FileStorage) LoadFromFile(ctx context.Context) (err error) {
+	defer func(start time.Time) { metrics.ObserveStorage("load", start, err) }(time.Now())
+	_, span := tracing.Start(ctx, "storage.load")
+	defer func() { span.RecordError(err); span.End() }()
+
 	fs.mx.Lock()
 	defer fs.mx.Unlock()
+	defer func() { metrics.StoredLinks.Set(float64(fs.store.Len())) }()
 
 	file, err := os.Open(fs.fileName)
 	if err != nil {
@@ -41,24 +62,191 @@ func (fs *FileStorage) LoadFromFile() error {
 		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
 			return err
 		}
-		fs.store.Set(record.ShortURL, record.OriginalURL)
+		fs.store.Put(record)
 	}
 	return scanner.Err()
 }
 
-func (fs *FileStorage) GetOriginalURL(id string) (string, error) {
+func (fs *FileStorage) GetOriginalURL(ctx context.Context, id string) (string, error) {
+	// Отсутствие ссылки — штатная ситуация, а не ошибка хранилища
+	defer metrics.ObserveStorage("get", time.Now(), nil)
+	_, span := tracing.Start(ctx, "storage.get")
+	defer span.End()
+
 	originalURL, ok := fs.store.Get(id)
 	if !ok {
-		return "", errors.New("original URL not found")
+		return "", ErrNotFound
 	}
 
 	return originalURL, nil
 }
 
-func (fs *FileStorage) SaveShortLink(shortLink models.ShortLink) error {
+// GetShortLink возвращает ссылку вместе с датой создания и числом переходов.
+func (fs *FileStorage) GetShortLink(ctx context.Context, id string) (models.ShortLink, error) {
+	defer metrics.ObserveStorage("get", time.Now(), nil)
+	_, span := tracing.Start(ctx, "storage.get")
+	defer span.End()
+
+	link, ok := fs.store.Link(id)
+	if !ok {
+		return models.ShortLink{}, ErrNotFound
+	}
+	return link, nil
+}
+
+// RecordClick засчитывает переход по ссылке и возвращает их общее число.
+// Статистика хранится только в памяти; исключение — счётчик ссылок с
+// MaxClicks, который дописывается в файл, чтобы лимит действовал и после
+// перезапуска. Если лимит исчерпан, возвращается ErrClickLimit.
+func (fs *FileStorage) RecordClick(ctx context.Context, id string, click models.Click) (clicks int64, err error) {
+	defer func(start time.Time) {
+		// Отсутствие ссылки и исчерпанный лимит — штатные ситуации
+		if errors.Is(err, ErrNotFound) || errors.Is(err, ErrClickLimit) {
+			metrics.ObserveStorage("click", start, nil)
+			return
+		}
+		metrics.ObserveStorage("click", start, err)
+	}(time.Now())
+	_, span := tracing.Start(ctx, "storage.click")
+	defer span.End()
+
+	clicks, err = fs.store.Click(id, click)
+	if err != nil {
+		return clicks, err
+	}
+
+	// Ссылка читается под fs.mx, чтобы строка со счётчиком не откатила
+	// в файле версию, сохранённую одновременно с переходом
+	fs.mx.Lock()
+	defer fs.mx.Unlock()
+	link, ok := fs.store.Link(id)
+	if !ok || link.MaxClicks == 0 {
+		return clicks, nil
+	}
+	link.UsedClicks = clicks
+	if err = fs.appendLine(link); err != nil {
+		span.RecordError(err)
+	}
+	return clicks, err
+}
+
+// GetStats возвращает статистику переходов по ссылке.
+func (fs *FileStorage) GetStats(ctx context.Context, id string) (models.LinkStats, error) {
+	defer metrics.ObserveStorage("stats", time.Now(), nil)
+	_, span := tracing.Start(ctx, "storage.stats")
+	defer span.End()
+
+	stats, ok := fs.store.Stats(id)
+	if !ok {
+		return models.LinkStats{}, ErrNotFound
+	}
+	return stats, nil
+}
+
+// GetHistory возвращает все версии ссылки, от первой до текущей. Число
+// переходов заполнено только у текущей версии.
+func (fs *FileStorage) GetHistory(ctx context.Context, id string) ([]models.ShortLink, error) {
+	defer metrics.ObserveStorage("history", time.Now(), nil)
+	_, span := tracing.Start(ctx, "storage.history")
+	defer span.End()
+
+	versions, ok := fs.store.History(id)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return versions, nil
+}
+
+// FindShortLinks возвращает ссылки, подходящие под filter, от новых к старым.
+func (fs *FileStorage) FindShortLinks(ctx context.Context, filter models.LinkFilter) []models.ShortLink {
+	defer metrics.ObserveStorage("find", time.Now(), nil)
+	_, span := tracing.Start(ctx, "storage.find")
+	defer span.End()
+
+	return fs.store.Find(filter)
+}
+
+// SaveShortLink сохраняет новую ссылку как её первую версию и возвращает её
+// в том виде, в каком она сохранена. Существующая ссылка не меняется: она
+// возвращается вместе с ErrLinkExists. Новые версии создаёт только
+// UpdateShortLink, где проверяется версия.
+func (fs *FileStorage) SaveShortLink(ctx context.Context, shortLink models.ShortLink) (saved models.ShortLink, err error) {
+	_, span := tracing.Start(ctx, "storage.save")
+	defer func(start time.Time) {
+		// Занятый идентификатор — ошибка клиента, а не хранилища
+		failure := err
+		if errors.Is(err, ErrLinkExists) {
+			failure = nil
+		}
+		metrics.ObserveStorage("save", start, failure)
+		span.RecordError(failure)
+		span.End()
+	}(time.Now())
+
+	fs.mx.Lock()
+	defer fs.mx.Unlock()
+
+	if current, ok := fs.store.Link(shortLink.ShortURL); ok {
+		return current, ErrLinkExists
+	}
+	shortLink.Version = 1
+	shortLink.UpdatedAt = time.Now().UTC()
+
+	if err = fs.appendLine(shortLink); err != nil {
+		return models.ShortLink{}, err
+	}
+	fs.store.Put(shortLink)
+	metrics.StoredLinks.Set(float64(fs.store.Len()))
+	saved, _ = fs.store.Link(shortLink.ShortURL)
+	return saved, nil
+}
+
+// UpdateShortLink изменяет ссылку id, если её текущая версия равна version,
+// иначе возвращает ErrVersionConflict. update получает текущую ссылку и
+// возвращает новую, которая сохраняется как следующая версия; ошибка update
+// возвращается как есть. update вызывается под блокировкой файла, поэтому
+// долгие проверки нужно выполнить до вызова.
+func (fs *FileStorage) UpdateShortLink(ctx context.Context, id string, version int, update func(models.ShortLink) (models.ShortLink, error)) (link models.ShortLink, err error) {
+	_, span := tracing.Start(ctx, "storage.update")
+	defer func(start time.Time) {
+		// Отсутствие ссылки и конфликт версий — ошибки клиента, а не хранилища
+		failure := err
+		if errors.Is(err, ErrNotFound) || errors.Is(err, ErrVersionConflict) {
+			failure = nil
+		}
+		metrics.ObserveStorage("update", start, failure)
+		span.RecordError(failure)
+		span.End()
+	}(time.Now())
+
 	fs.mx.Lock()
 	defer fs.mx.Unlock()
 
+	current, ok := fs.store.Link(id)
+	if !ok {
+		return models.ShortLink{}, ErrNotFound
+	}
+	if current.Version != version {
+		return current, ErrVersionConflict
+	}
+	next, err := update(current)
+	if err != nil {
+		return current, err
+	}
+	next.ShortURL = id
+	next.Version = current.Version + 1
+	next.UpdatedAt = time.Now().UTC()
+
+	if err = fs.appendLine(next); err != nil {
+		return current, err
+	}
+	fs.store.Put(next)
+	link, _ = fs.store.Link(id)
+	return link, nil
+}
+
+// appendLine дописывает запись о ссылке в конец файла. Вызывается под fs.mx.
+func (fs *FileStorage) appendLine(shortLink models.ShortLink) error {
 	file, err := os.OpenFile(fs.fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		return err
@@ -70,6 +258,5 @@ func (fs *FileStorage) SaveShortLink(shortLink models.ShortLink) error {
 		return err
 	}
 	_, err = file.WriteString(string(jsonLine) + "\n")
-	fs.store.Set(shortLink.ShortURL, shortLink.OriginalURL)
 	return err
 }
@@ -1,27 +1,283 @@
 package storage
 
-import "sync"
+import (
+	"github.com/ivanlp-p/ShortLinkService/internal/models"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// entry — запись о ссылке вместе со статистикой переходов.
+type entry struct {
+	link   models.ShortLink
+	clicks atomic.Int64
+
+	statsMu   sync.Mutex
+	variants  map[string]int64
+	countries map[string]int64
+
+	// history — прежние версии ссылки, от старых к новым.
+	history []models.ShortLink
+}
+
+// linkIndex — множество идентификаторов ссылок по ключу.
+type linkIndex map[string]map[string]struct{}
+
+func (ix linkIndex) add(key, id string) {
+	if ix[key] == nil {
+		ix[key] = make(map[string]struct{})
+	}
+	ix[key][id] = struct{}{}
+}
+
+func (ix linkIndex) remove(key, id string) {
+	delete(ix[key], id)
+	if len(ix[key]) == 0 {
+		delete(ix, key)
+	}
+}
 
 type MapStorage struct {
-	data map[string]string
+	data map[string]*entry
 	mu   sync.RWMutex
+
+	// byUser и byTag — ссылки по владельцу и по метке, для поиска в Find.
+	byUser linkIndex
+	byTag  linkIndex
 }
 
 func NewMapStorage() *MapStorage {
 	return &MapStorage{
-		data: make(map[string]string),
+		data:   make(map[string]*entry),
+		byUser: make(linkIndex),
+		byTag:  make(linkIndex),
 	}
 }
 
 func (s *MapStorage) Set(id string, url string) {
+	s.Put(models.ShortLink{ShortURL: id, OriginalURL: url})
+}
+
+// Put сохраняет ссылку целиком. У уже существующей ссылки сохраняются
+// счётчик переходов, дата создания и владелец, а если Version больше
+// прежней, прежняя версия попадает в историю. UsedClicks переносится в
+// счётчик, если он больше текущего значения.
+func (s *MapStorage) Put(link models.ShortLink) {
+	used := link.UsedClicks
+	link.UsedClicks, link.Clicks = 0, 0
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.data[id] = url
+	if e, ok := s.data[link.ShortURL]; ok {
+		if !e.link.CreatedAt.IsZero() {
+			link.CreatedAt = e.link.CreatedAt
+		}
+		if e.link.UserID != "" {
+			link.UserID = e.link.UserID
+		}
+		if link.Version > e.link.Version {
+			e.history = append(e.history, e.link)
+		}
+		s.unindex(e.link)
+		s.index(link)
+		e.link = link
+		raise(&e.clicks, used)
+		return
+	}
+	e := &entry{link: link}
+	e.clicks.Store(used)
+	s.data[link.ShortURL] = e
+	s.index(link)
+}
+
+// index добавляет ссылку в индексы поиска. Вызывается под s.mu.
+func (s *MapStorage) index(link models.ShortLink) {
+	if link.UserID != "" {
+		s.byUser.add(link.UserID, link.ShortURL)
+	}
+	for _, tag := range link.Tags {
+		s.byTag.add(tag, link.ShortURL)
+	}
+}
+
+// unindex удаляет ссылку из индексов поиска. Вызывается под s.mu.
+func (s *MapStorage) unindex(link models.ShortLink) {
+	if link.UserID != "" {
+		s.byUser.remove(link.UserID, link.ShortURL)
+	}
+	for _, tag := range link.Tags {
+		s.byTag.remove(tag, link.ShortURL)
+	}
+}
+
+// raise увеличивает v до n, если v меньше.
+func raise(v *atomic.Int64, n int64) {
+	for {
+		cur := v.Load()
+		if cur >= n || v.CompareAndSwap(cur, n) {
+			return
+		}
+	}
 }
 
 func (s *MapStorage) Get(id string) (string, bool) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	url, ok := s.data[id]
-	return url, ok
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, ok := s.data[id]
+	if !ok {
+		return "", false
+	}
+	return e.link.OriginalURL, true
+}
+
+// Link возвращает ссылку с текущим числом переходов.
+func (s *MapStorage) Link(id string) (models.ShortLink, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, ok := s.data[id]
+	if !ok {
+		return models.ShortLink{}, false
+	}
+	link := e.link
+	link.Clicks = e.clicks.Load()
+	return link, true
+}
+
+// Find возвращает ссылки, подходящие под filter, от новых к старым.
+// Кандидаты берутся из меньшего из индексов по владельцу и по метке, так
+// что поиск не просматривает ссылки других пользователей.
+func (s *MapStorage) Find(filter models.LinkFilter) []models.ShortLink {
+	query := strings.ToLower(filter.Query)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var candidates map[string]struct{}
+	switch {
+	case filter.UserID != "" && filter.Tag != "":
+		candidates = s.byUser[filter.UserID]
+		if len(s.byTag[filter.Tag]) < len(candidates) {
+			candidates = s.byTag[filter.Tag]
+		}
+	case filter.UserID != "":
+		candidates = s.byUser[filter.UserID]
+	case filter.Tag != "":
+		candidates = s.byTag[filter.Tag]
+	default:
+		candidates = make(map[string]struct{}, len(s.data))
+		for id := range s.data {
+			candidates[id] = struct{}{}
+		}
+	}
+
+	var links []models.ShortLink
+	for id := range candidates {
+		e := s.data[id]
+		if filter.UserID != "" && e.link.UserID != filter.UserID {
+			continue
+		}
+		if filter.Tag != "" && !slices.Contains(e.link.Tags, filter.Tag) {
+			continue
+		}
+		if query != "" &&
+			!strings.Contains(strings.ToLower(e.link.Title), query) &&
+			!strings.Contains(strings.ToLower(e.link.OriginalURL), query) {
+			continue
+		}
+		link := e.link
+		link.Clicks = e.clicks.Load()
+		links = append(links, link)
+	}
+	slices.SortFunc(links, func(a, b models.ShortLink) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ShortURL, b.ShortURL)
+	})
+	return links
+}
+
+// History возвращает все версии ссылки, от первой до текущей. Счётчик
+// переходов у ссылки один на все версии, поэтому Clicks заполняется только
+// у текущей версии, а у прежних остаётся нулевым.
+func (s *MapStorage) History(id string) ([]models.ShortLink, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, ok := s.data[id]
+	if !ok {
+		return nil, false
+	}
+	versions := make([]models.ShortLink, 0, len(e.history)+1)
+	versions = append(versions, e.history...)
+	current := e.link
+	current.Clicks = e.clicks.Load()
+	return append(versions, current), true
+}
+
+// Click засчитывает переход по ссылке и возвращает новое число переходов.
+// Если у ссылки задан MaxClicks и лимит исчерпан, переход не засчитывается
+// и возвращается ErrClickLimit: проверка и увеличение счётчика атомарны,
+// поэтому одновременные запросы не могут превысить лимит.
+func (s *MapStorage) Click(id string, click models.Click) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, ok := s.data[id]
+	if !ok {
+		return 0, ErrNotFound
+	}
+
+	var clicks int64
+	for {
+		cur := e.clicks.Load()
+		if e.link.MaxClicks > 0 && cur >= e.link.MaxClicks {
+			return cur, ErrClickLimit
+		}
+		if e.clicks.CompareAndSwap(cur, cur+1) {
+			clicks = cur + 1
+			break
+		}
+	}
+
+	if click.Variant != "" || click.Country != "" {
+		e.statsMu.Lock()
+		count(&e.variants, click.Variant)
+		count(&e.countries, click.Country)
+		e.statsMu.Unlock()
+	}
+	return clicks, nil
+}
+
+// Stats возвращает статистику переходов по ссылке.
+func (s *MapStorage) Stats(id string) (models.LinkStats, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, ok := s.data[id]
+	if !ok {
+		return models.LinkStats{}, false
+	}
+	e.statsMu.Lock()
+	defer e.statsMu.Unlock()
+	return models.LinkStats{
+		Clicks:    e.clicks.Load(),
+		Variants:  maps.Clone(e.variants),
+		Countries: maps.Clone(e.countries),
+	}, true
+}
+
+// count увеличивает счётчик key, пропуская пустые ключи.
+func count(m *map[string]int64, key string) {
+	if key == "" {
+		return
+	}
+	if *m == nil {
+		*m = make(map[string]int64)
+	}
+	(*m)[key]++
+}
+
+func (s *MapStorage) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.data)
 }
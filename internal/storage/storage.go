@@ -1,6 +1,15 @@
 package storage
 
+import "github.com/ivanlp-p/ShortLinkService/internal/models"
+
 type Storage interface {
 	Set(id string, url string)
+	Put(link models.ShortLink)
 	Get(id string) (string, bool)
+	Link(id string) (models.ShortLink, bool)
+	Click(id string, click models.Click) (int64, error)
+	Stats(id string) (models.LinkStats, bool)
+	History(id string) ([]models.ShortLink, bool)
+	Find(filter models.LinkFilter) []models.ShortLink
+	Len() int
 }
@@ -0,0 +1,218 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Exporter отправляет завершённые спаны во внешнюю систему.
+type Exporter interface {
+	Export(ctx context.Context, spans []SpanData) error
+}
+
+// StdoutExporter пишет каждый спан отдельной JSON-строкой.
+type StdoutExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewStdoutExporter(w io.Writer) *StdoutExporter {
+	return &StdoutExporter{w: w}
+}
+
+type jsonSpan struct {
+	TraceID      string         `json:"trace_id"`
+	SpanID       string         `json:"span_id"`
+	ParentSpanID string         `json:"parent_span_id,omitempty"`
+	TraceState   string         `json:"trace_state,omitempty"`
+	Name         string         `json:"name"`
+	Kind         SpanKind       `json:"kind"`
+	Start        time.Time      `json:"start"`
+	End          time.Time      `json:"end"`
+	Attributes   map[string]any `json:"attributes,omitempty"`
+	Error        string         `json:"error,omitempty"`
+}
+
+func (e *StdoutExporter) Export(_ context.Context, spans []SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	enc := json.NewEncoder(e.w)
+	for _, s := range spans {
+		js := jsonSpan{
+			TraceID:    s.SpanContext.TraceID.String(),
+			SpanID:     s.SpanContext.SpanID.String(),
+			TraceState: s.SpanContext.TraceState,
+			Name:       s.Name,
+			Kind:       s.Kind,
+			Start:      s.Start,
+			End:        s.End,
+			Attributes: s.Attributes,
+			Error:      s.Err,
+		}
+		if s.ParentSpanID.IsValid() {
+			js.ParentSpanID = s.ParentSpanID.String()
+		}
+		if err := enc.Encode(js); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OTLPExporter отправляет спаны коллектору по OTLP/HTTP в JSON-кодировке.
+type OTLPExporter struct {
+	endpoint    string
+	serviceName string
+	client      *http.Client
+}
+
+// NewOTLPExporter создаёт экспортёр. endpoint — базовый адрес коллектора,
+// например http://localhost:4318; путь /v1/traces добавляется автоматически.
+func NewOTLPExporter(endpoint, serviceName string) *OTLPExporter {
+	return &OTLPExporter{
+		endpoint:    strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		serviceName: serviceName,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		TraceState        string         `json:"traceState,omitempty"`
+		Name              string         `json:"name"`
+		Kind              SpanKind       `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		Status            otlpStatus     `json:"status"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+	otlpKeyValue struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+	}
+)
+
+const (
+	otlpStatusOK    = 1
+	otlpStatusError = 2
+)
+
+func otlpAttr(key string, v any) otlpKeyValue {
+	kv := otlpKeyValue{Key: key}
+	switch val := v.(type) {
+	case string:
+		kv.Value.StringValue = &val
+	case int:
+		s := strconv.Itoa(val)
+		kv.Value.IntValue = &s
+	case int64:
+		s := strconv.FormatInt(val, 10)
+		kv.Value.IntValue = &s
+	case float64:
+		kv.Value.DoubleValue = &val
+	case bool:
+		kv.Value.BoolValue = &val
+	default:
+		s := fmt.Sprint(val)
+		kv.Value.StringValue = &s
+	}
+	return kv
+}
+
+func (e *OTLPExporter) Export(ctx context.Context, spans []SpanData) error {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		span := otlpSpan{
+			TraceID:           s.SpanContext.TraceID.String(),
+			SpanID:            s.SpanContext.SpanID.String(),
+			TraceState:        s.SpanContext.TraceState,
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Status:            otlpStatus{Code: otlpStatusOK},
+		}
+		if s.ParentSpanID.IsValid() {
+			span.ParentSpanID = s.ParentSpanID.String()
+		}
+		for k, v := range s.Attributes {
+			span.Attributes = append(span.Attributes, otlpAttr(k, v))
+		}
+		if s.Err != "" {
+			span.Status = otlpStatus{Code: otlpStatusError, Message: s.Err}
+		}
+		out = append(out, span)
+	}
+
+	body, err := json.Marshal(otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: []otlpKeyValue{otlpAttr("service.name", e.serviceName)},
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: "github.com/ivanlp-p/ShortLinkService/internal/tracing"},
+				Spans: out,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("otlp export: collector responded %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// collector имитирует OTLP/HTTP-коллектор и запоминает полученные спаны.
+type collector struct {
+	mu    sync.Mutex
+	spans []otlpSpan
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+		return
+	}
+	var req otlpRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			c.spans = append(c.spans, ss.Spans...)
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestOTLPExporter_Middleware(t *testing.T) {
+	col := &collector{}
+	srv := httptest.NewServer(col)
+	defer srv.Close()
+
+	prev := Default
+	Default = NewTracer(NewOTLPExporter(srv.URL, "shortener-test"))
+	t.Cleanup(func() { Default = prev })
+
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, span := Start(r.Context(), "storage.get")
+		span.End()
+		w.WriteHeader(http.StatusTemporaryRedirect)
+	}))
+
+	request := httptest.NewRequest(http.MethodGet, "/abc", nil)
+	request.Header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h(httptest.NewRecorder(), request)
+
+	unsampled := httptest.NewRequest(http.MethodGet, "/abc", nil)
+	unsampled.Header.Set(TraceparentHeader, "00-11111111111111111111111111111111-00f067aa0ba902b7-00")
+	h(httptest.NewRecorder(), unsampled)
+
+	require.NoError(t, Default.Shutdown(context.Background()))
+
+	col.mu.Lock()
+	defer col.mu.Unlock()
+	require.Len(t, col.spans, 2, "only spans of the sampled trace are exported")
+
+	child, server := col.spans[0], col.spans[1]
+	assert.Equal(t, "storage.get", child.Name)
+	assert.Equal(t, "GET", server.Name)
+	assert.Equal(t, SpanKindServer, server.Kind)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", server.ParentSpanID)
+	assert.Equal(t, server.TraceID, child.TraceID)
+	assert.Equal(t, server.SpanID, child.ParentSpanID)
+}
+
+func TestOTLPExporter_CollectorError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	exp := NewOTLPExporter(srv.URL, "shortener-test")
+	err := exp.Export(context.Background(), []SpanData{{Name: "x"}})
+	assert.ErrorContains(t, err, "503")
+}
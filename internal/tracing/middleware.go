@@ -0,0 +1,55 @@
+package tracing
+
+import (
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+)
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(statusCode int) {
+	r.status = statusCode
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Middleware оборачивает обработчик серверным спаном. Контекст родителя
+// берётся из заголовков traceparent/tracestate входящего запроса.
+func Middleware(h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := Extract(r.Context(), r.Header)
+
+		name := r.Method
+		if rctx := chi.RouteContext(ctx); rctx != nil && rctx.RoutePattern() != "" {
+			name += " " + rctx.RoutePattern()
+		}
+
+		ctx, span := Default.Start(ctx, name, SpanKindServer)
+		defer span.End()
+
+		span.SetAttribute("http.request.method", r.Method)
+		span.SetAttribute("url.path", r.URL.Path)
+		span.SetAttribute("user_agent.original", r.UserAgent())
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(rec, r.WithContext(ctx))
+
+		span.SetAttribute("http.response.status_code", rec.status)
+		if rec.status >= http.StatusInternalServerError {
+			span.RecordError(errors.New(http.StatusText(rec.status)))
+		}
+	}
+}
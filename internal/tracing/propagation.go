@@ -0,0 +1,133 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Заголовки W3C Trace Context, см. https://www.w3.org/TR/trace-context/
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+const (
+	traceparentVersion = "00"
+	flagSampled        = 0x01
+)
+
+// TraceID — 16-байтовый идентификатор трассы.
+type TraceID [16]byte
+
+// SpanID — 8-байтовый идентификатор спана.
+type SpanID [8]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+// IsValid сообщает, что идентификатор не нулевой.
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+
+// IsValid сообщает, что идентификатор не нулевой.
+func (s SpanID) IsValid() bool { return s != SpanID{} }
+
+// SpanContext — часть спана, которая передаётся между сервисами.
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Flags      byte
+	TraceState string
+	Remote     bool
+}
+
+// IsValid сообщает, что контекст содержит корректные идентификаторы.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// IsSampled сообщает, что трасса должна экспортироваться.
+func (sc SpanContext) IsSampled() bool {
+	return sc.Flags&flagSampled != 0
+}
+
+// Traceparent форматирует контекст в значение заголовка traceparent.
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf("%s-%s-%s-%02x", traceparentVersion, sc.TraceID, sc.SpanID, sc.Flags)
+}
+
+// ParseTraceparent разбирает значение заголовка traceparent.
+// Неизвестные будущие версии разбираются по формату версии 00, как требует спецификация.
+func ParseTraceparent(value string) (SpanContext, error) {
+	var sc SpanContext
+
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 {
+		return sc, fmt.Errorf("traceparent %q: expected 4 fields", value)
+	}
+	version, traceID, spanID, flags := parts[0], parts[1], parts[2], parts[3]
+
+	if len(version) != 2 || version == "ff" || !isLowerHex(version) {
+		return sc, fmt.Errorf("traceparent %q: invalid version", value)
+	}
+	if version == traceparentVersion && len(parts) != 4 {
+		return sc, fmt.Errorf("traceparent %q: unexpected trailing fields", value)
+	}
+	if len(traceID) != 32 || !isLowerHex(traceID) {
+		return sc, fmt.Errorf("traceparent %q: invalid trace-id", value)
+	}
+	if len(spanID) != 16 || !isLowerHex(spanID) {
+		return sc, fmt.Errorf("traceparent %q: invalid parent-id", value)
+	}
+	if len(flags) != 2 || !isLowerHex(flags) {
+		return sc, fmt.Errorf("traceparent %q: invalid trace-flags", value)
+	}
+
+	hex.Decode(sc.TraceID[:], []byte(traceID))
+	hex.Decode(sc.SpanID[:], []byte(spanID))
+	var f [1]byte
+	hex.Decode(f[:], []byte(flags))
+	sc.Flags = f[0]
+
+	if !sc.IsValid() {
+		return SpanContext{}, fmt.Errorf("traceparent %q: all-zero identifiers", value)
+	}
+	sc.Remote = true
+	return sc, nil
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// Extract достаёт контекст родительского спана из заголовков входящего запроса.
+func Extract(ctx context.Context, h http.Header) context.Context {
+	sc, err := ParseTraceparent(h.Get(TraceparentHeader))
+	if err != nil {
+		return ctx
+	}
+	// tracestate без корректного traceparent не имеет смысла
+	sc.TraceState = strings.Join(h.Values(TracestateHeader), ",")
+	return context.WithValue(ctx, remoteKey, sc)
+}
+
+// Inject записывает текущий контекст трассировки в заголовки исходящего запроса.
+func Inject(ctx context.Context, h http.Header) {
+	sc := SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	h.Set(TraceparentHeader, sc.Traceparent())
+	if sc.TraceState != "" {
+		h.Set(TracestateHeader, sc.TraceState)
+	} else {
+		h.Del(TracestateHeader)
+	}
+}
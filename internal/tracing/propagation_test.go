@@ -0,0 +1,92 @@
+package tracing
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+		sampled bool
+	}{
+		{
+			name:    "sampled",
+			value:   "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			sampled: true,
+		},
+		{
+			name:  "not_sampled",
+			value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+		},
+		{
+			name:    "future_version_with_extra_fields",
+			value:   "cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-what",
+			sampled: true,
+		},
+		{
+			name:    "version_ff",
+			value:   "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			wantErr: true,
+		},
+		{
+			name:    "zero_trace_id",
+			value:   "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+			wantErr: true,
+		},
+		{
+			name:    "uppercase_hex",
+			value:   "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+			wantErr: true,
+		},
+		{
+			name:    "short_span_id",
+			value:   "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa-01",
+			wantErr: true,
+		},
+		{
+			name:    "empty",
+			value:   "",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, err := ParseTraceparent(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+			assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+			assert.Equal(t, tt.sampled, sc.IsSampled())
+		})
+	}
+}
+
+func TestExtractInject(t *testing.T) {
+	in := http.Header{}
+	in.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	in.Add(TracestateHeader, "congo=t61rcWkgMzE")
+	in.Add(TracestateHeader, "rojo=00f067aa0ba902b7")
+
+	tracer := NewTracer(nil)
+	ctx, span := tracer.Start(Extract(context.Background(), in), "child", SpanKindServer)
+	defer span.End()
+
+	out := http.Header{}
+	Inject(ctx, out)
+
+	sc, err := ParseTraceparent(out.Get(TraceparentHeader))
+	require.NoError(t, err)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String(), "trace id must be kept")
+	assert.Equal(t, span.SpanContext().SpanID, sc.SpanID, "parent id must be the current span")
+	assert.NotEqual(t, "00f067aa0ba902b7", sc.SpanID.String())
+	assert.Equal(t, "congo=t61rcWkgMzE,rojo=00f067aa0ba902b7", out.Get(TracestateHeader))
+}
@@ -0,0 +1,242 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"sync"
+	"time"
+)
+
+// SpanKind повторяет значения OTLP.
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+// SpanData — завершённый спан, который передаётся экспортёру.
+type SpanData struct {
+	Name         string
+	Kind         SpanKind
+	SpanContext  SpanContext
+	ParentSpanID SpanID
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]any
+	Err          string
+}
+
+// Span — спан в процессе выполнения. Методы Span безопасны для вызова на nil.
+type Span struct {
+	tracer *Tracer
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+// SpanContext возвращает распространяемую часть спана.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.data.SpanContext
+}
+
+// SetAttribute добавляет атрибут к спану.
+func (s *Span) SetAttribute(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Attributes[key] = value
+}
+
+// RecordError помечает спан как завершившийся ошибкой.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Err = err.Error()
+}
+
+// End завершает спан и передаёт его экспортёру, если трасса сэмплирована.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	if data.SpanContext.IsSampled() {
+		s.tracer.enqueue(data)
+	}
+}
+
+// Tracer создаёт спаны и пачками отправляет их экспортёру.
+type Tracer struct {
+	exporter Exporter
+
+	mu      sync.Mutex
+	pending []SpanData
+
+	batchSize int
+	flushCh   chan struct{}
+	done      chan struct{}
+	stopped   chan struct{}
+}
+
+const (
+	defaultBatchSize     = 128
+	defaultFlushInterval = 5 * time.Second
+)
+
+// NewTracer создаёт трассировщик. При exporter == nil спаны создаются
+// и распространяются, но никуда не отправляются.
+func NewTracer(exporter Exporter) *Tracer {
+	t := &Tracer{
+		exporter:  exporter,
+		batchSize: defaultBatchSize,
+		flushCh:   make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	if exporter != nil {
+		go t.loop(defaultFlushInterval)
+	} else {
+		close(t.stopped)
+	}
+	return t
+}
+
+// Default — трассировщик сервиса. По умолчанию ничего не экспортирует.
+var Default = NewTracer(nil)
+
+// Start начинает дочерний спан текущего спана из ctx через Default.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	return Default.Start(ctx, name, SpanKindInternal)
+}
+
+// Start начинает спан. Родителем становится спан из ctx или удалённый контекст,
+// извлечённый Extract. Без родителя начинается новая сэмплированная трасса.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	parent := SpanContextFromContext(ctx)
+
+	sc := SpanContext{Flags: flagSampled}
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.Flags = parent.Flags
+		sc.TraceState = parent.TraceState
+	} else {
+		rand.Read(sc.TraceID[:])
+	}
+	rand.Read(sc.SpanID[:])
+
+	span := &Span{
+		tracer: t,
+		data: SpanData{
+			Name:         name,
+			Kind:         kind,
+			SpanContext:  sc,
+			ParentSpanID: parent.SpanID,
+			Start:        time.Now(),
+			Attributes:   make(map[string]any),
+		},
+	}
+	return context.WithValue(ctx, spanKey, span), span
+}
+
+func (t *Tracer) enqueue(data SpanData) {
+	if t.exporter == nil {
+		return
+	}
+	t.mu.Lock()
+	t.pending = append(t.pending, data)
+	full := len(t.pending) >= t.batchSize
+	t.mu.Unlock()
+
+	if full {
+		select {
+		case t.flushCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (t *Tracer) loop(interval time.Duration) {
+	defer close(t.stopped)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.Flush(context.Background())
+		case <-t.flushCh:
+			t.Flush(context.Background())
+		case <-t.done:
+			return
+		}
+	}
+}
+
+// Flush немедленно отправляет накопленные спаны.
+func (t *Tracer) Flush(ctx context.Context) error {
+	if t.exporter == nil {
+		return nil
+	}
+	t.mu.Lock()
+	batch := t.pending
+	t.pending = nil
+	t.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+	return t.exporter.Export(ctx, batch)
+}
+
+// Shutdown останавливает фоновую отправку и досылает оставшиеся спаны.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	select {
+	case <-t.done:
+	default:
+		close(t.done)
+	}
+	<-t.stopped
+	return t.Flush(ctx)
+}
+
+type ctxKey int
+
+const (
+	spanKey ctxKey = iota
+	remoteKey
+)
+
+// SpanFromContext возвращает текущий спан или nil.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey).(*Span)
+	return s
+}
+
+// SpanContextFromContext возвращает контекст текущего спана,
+// а если его нет — удалённый контекст из входящего запроса.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if s := SpanFromContext(ctx); s != nil {
+		return s.SpanContext()
+	}
+	sc, _ := ctx.Value(remoteKey).(SpanContext)
+	return sc
+}
@@ -0,0 +1,95 @@
+// Package useragent определяет по заголовку User-Agent операционную систему,
+// класс устройства и признак бота. Разбор эвристический и рассчитан только
+// на выбор адреса назначения, а не на точную статистику.
+package useragent
+
+import "strings"
+
+// Операционные системы.
+const (
+	OSiOS      = "ios"
+	OSAndroid  = "android"
+	OSWindows  = "windows"
+	OSMacOS    = "macos"
+	OSLinux    = "linux"
+	OSChromeOS = "chromeos"
+)
+
+// Классы устройств.
+const (
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceDesktop = "desktop"
+)
+
+// Info — результат разбора User-Agent. Пустой OS означает, что система не распознана.
+type Info struct {
+	OS     string
+	Device string
+	Bot    bool
+}
+
+// KnownOS сообщает, поддерживается ли os в правилах.
+func KnownOS(os string) bool {
+	switch os {
+	case OSiOS, OSAndroid, OSWindows, OSMacOS, OSLinux, OSChromeOS:
+		return true
+	}
+	return false
+}
+
+// KnownDevice сообщает, поддерживается ли класс устройства в правилах.
+func KnownDevice(device string) bool {
+	switch device {
+	case DeviceMobile, DeviceTablet, DeviceDesktop:
+		return true
+	}
+	return false
+}
+
+// botMarkers — подстроки, по которым опознаются роботы и HTTP-клиенты без браузера.
+var botMarkers = []string{
+	"bot", "crawl", "spider", "slurp", "preview", "facebookexternalhit",
+	"curl/", "wget/", "python-requests", "go-http-client", "headless",
+}
+
+// Parse разбирает значение заголовка User-Agent.
+func Parse(ua string) Info {
+	s := strings.ToLower(ua)
+	var info Info
+
+	for _, marker := range botMarkers {
+		if strings.Contains(s, marker) {
+			info.Bot = true
+			break
+		}
+	}
+
+	// Порядок важен: мобильные системы упоминают в строке и настольные
+	switch {
+	case strings.Contains(s, "iphone"), strings.Contains(s, "ipad"), strings.Contains(s, "ipod"):
+		info.OS = OSiOS
+	case strings.Contains(s, "android"):
+		info.OS = OSAndroid
+	case strings.Contains(s, "windows"):
+		info.OS = OSWindows
+	case strings.Contains(s, "cros"):
+		info.OS = OSChromeOS
+	case strings.Contains(s, "macintosh"), strings.Contains(s, "mac os x"):
+		info.OS = OSMacOS
+	case strings.Contains(s, "linux"):
+		info.OS = OSLinux
+	}
+
+	switch {
+	case strings.Contains(s, "ipad"), strings.Contains(s, "tablet"),
+		info.OS == OSAndroid && !strings.Contains(s, "mobile"):
+		info.Device = DeviceTablet
+	case strings.Contains(s, "mobi"), strings.Contains(s, "iphone"), strings.Contains(s, "ipod"),
+		strings.Contains(s, "windows phone"):
+		info.Device = DeviceMobile
+	default:
+		info.Device = DeviceDesktop
+	}
+	return info
+}
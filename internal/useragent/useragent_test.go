@@ -0,0 +1,74 @@
+package useragent
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		ua   string
+		want Info
+	}{
+		{
+			name: "iphone",
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1",
+			want: Info{OS: OSiOS, Device: DeviceMobile},
+		},
+		{
+			name: "ipad",
+			ua:   "Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Mobile/15E148 Safari/604.1",
+			want: Info{OS: OSiOS, Device: DeviceTablet},
+		},
+		{
+			name: "android_phone",
+			ua:   "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36",
+			want: Info{OS: OSAndroid, Device: DeviceMobile},
+		},
+		{
+			name: "android_tablet",
+			ua:   "Mozilla/5.0 (Linux; Android 13; SM-X710) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+			want: Info{OS: OSAndroid, Device: DeviceTablet},
+		},
+		{
+			name: "windows",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+			want: Info{OS: OSWindows, Device: DeviceDesktop},
+		},
+		{
+			name: "macos",
+			ua:   "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Safari/605.1.15",
+			want: Info{OS: OSMacOS, Device: DeviceDesktop},
+		},
+		{
+			name: "linux",
+			ua:   "Mozilla/5.0 (X11; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0",
+			want: Info{OS: OSLinux, Device: DeviceDesktop},
+		},
+		{
+			name: "chromeos",
+			ua:   "Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+			want: Info{OS: OSChromeOS, Device: DeviceDesktop},
+		},
+		{
+			name: "googlebot_mobile",
+			ua:   "Mozilla/5.0 (Linux; Android 6.0.1; Nexus 5X Build/MMB29P) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Mobile Safari/537.36 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			want: Info{OS: OSAndroid, Device: DeviceMobile, Bot: true},
+		},
+		{
+			name: "curl",
+			ua:   "curl/8.5.0",
+			want: Info{Device: DeviceDesktop, Bot: true},
+		},
+		{
+			name: "empty",
+			want: Info{Device: DeviceDesktop},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Parse(tt.ua))
+		})
+	}
+}